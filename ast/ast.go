@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"math/big"
 	"monkey/token"
 	"strings"
 )
@@ -10,6 +11,7 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position //ソース上の位置。エラー表示に使う
 }
 
 //文（Statement）は値を生成しない
@@ -27,6 +29,7 @@ type Expression interface {
 //programはstatements(文の集合)を保持する。
 type Program struct {
 	Statements []Statement
+	Comments   []token.Comment //ソース中の全コメント(字句解析器のKeepCommentsがtrueの時のみ)
 }
 
 //デバッグ時にASTノードを表示したり、他のASTと比較したりできる。各Nodeに定義されたString()で実際に仕事している。
@@ -40,6 +43,13 @@ func (p *Program) String() string {
 	return out.String() //バッファを文字列として返却する。
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
 func (p *Program) TokenLiteral() string {
 	if len(p.Statements) > 0 {
 		return p.Statements[0].TokenLiteral()
@@ -48,15 +58,19 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
-//let文
+//let文。const x = 1; も同じ形なので、Tokenで区別する
 type LetStatement struct {
-	Token token.Token
+	Token token.Token //'let'か'const'トークン
 	Name  *Identifier //識別子の名前が入る
 	Value Expression  //代入する値が入る。
 }
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position  { return ls.Token.Pos }
+
+//const宣言かどうか
+func (ls *LetStatement) IsConst() bool { return ls.Token.Type == token.CONST }
 
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
@@ -80,6 +94,7 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos }
 
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
@@ -93,6 +108,48 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+//break文。Labelがある場合はそのラベルのループを抜ける
+type BreakStatement struct {
+	Token token.Token //'break'トークン
+	Label *Identifier
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.Position  { return bs.Token.Pos }
+
+func (bs *BreakStatement) String() string {
+	if bs.Label != nil {
+		return bs.TokenLiteral() + " " + bs.Label.String() + ";"
+	}
+	return bs.TokenLiteral() + ";"
+}
+
+//continue文。Labelがある場合はそのラベルのループの次の繰り返しへ進む
+type ContinueStatement struct {
+	Token token.Token //'continue'トークン
+	Label *Identifier
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.Position  { return cs.Token.Pos }
+
+func (cs *ContinueStatement) String() string {
+	if cs.Label != nil {
+		return cs.TokenLiteral() + " " + cs.Label.String() + ";"
+	}
+	return cs.TokenLiteral() + ";"
+}
+
+//ループのラベル outer: while (...) { ... } を文字列にする
+func labelString(label *Identifier) string {
+	if label == nil {
+		return ""
+	}
+	return label.String() + ": "
+}
+
 //式文。行にある x + 5;のような単体式
 type ExpressionStatement struct {
 	Token      token.Token //式の最初のトークン
@@ -101,6 +158,7 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return es.Token.Pos }
 
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
@@ -117,18 +175,32 @@ type Identifier struct {
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
 func (i *Identifier) String() string       { return i.Value }
 
 //整数リテラル(値)
 type IntegerLiteral struct {
 	Token token.Token
-	Value int64 //"5"という値を5に変換する必要がある。
+	Value int64    //"5"という値を5に変換する必要がある。
+	Big   *big.Int //int64に収まらない場合のみ値が入る(その時Valueは0)
 }
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+//浮動小数点数リテラル(値)
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
 //前置演算子式
 type PrefixExpression struct {
 	Token    token.Token //前置トークン.ex「!」など
@@ -138,6 +210,7 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -159,6 +232,7 @@ type InfixExpression struct {
 
 func (oe *InfixExpression) expressionNode()      {}
 func (oe *InfixExpression) TokenLiteral() string { return oe.Token.Literal }
+func (oe *InfixExpression) Pos() token.Position  { return oe.Token.Pos }
 func (oe *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -180,6 +254,7 @@ type PostfixExpression struct {
 
 func (pe *PostfixExpression) expressionNode()      {}
 func (pe *PostfixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PostfixExpression) Pos() token.Position  { return pe.Token.Pos }
 func (pe *PostfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -199,6 +274,7 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position  { return b.Token.Pos }
 func (b *Boolean) String() string       { return b.Token.Literal }
 
 type IfExpression struct {
@@ -210,6 +286,7 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -233,6 +310,7 @@ type BlockStatement struct {
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -250,6 +328,7 @@ type FunctionLiteral struct {
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -275,6 +354,7 @@ type FunctionStatement struct {
 
 func (f *FunctionStatement) statementNode()       {}
 func (f *FunctionStatement) TokenLiteral() string { return f.Token.Literal }
+func (f *FunctionStatement) Pos() token.Position  { return f.Token.Pos }
 
 func (f *FunctionStatement) String() string {
 	var out bytes.Buffer
@@ -303,6 +383,7 @@ type CallExpression struct {
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position  { return ce.Token.Pos }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -325,8 +406,34 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
+//埋め込み式のある文字列 "total: ${sum}"
+type InterpolatedString struct {
+	Token token.Token  //INTERP_HEADトークン
+	Parts []Expression //*StringLiteralと埋め込み式が交互に並ぶ
+}
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) Pos() token.Position  { return is.Token.Pos }
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	for _, part := range is.Parts {
+		if str, ok := part.(*StringLiteral); ok {
+			out.WriteString(str.Value)
+			continue
+		}
+		out.WriteString("${")
+		out.WriteString(part.String())
+		out.WriteString("}")
+	}
+
+	return out.String()
+}
+
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
@@ -334,6 +441,7 @@ type ArrayLiteral struct {
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -356,6 +464,7 @@ type IndexExpression struct {
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
@@ -375,6 +484,7 @@ type HashLiteral struct {
 
 func (hl *HashLiteral) expressionNode()      {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
@@ -391,15 +501,18 @@ func (hl *HashLiteral) String() string {
 
 type WhileExpression struct {
 	Token       token.Token //WhileToken
+	Label       *Identifier //break/continueで指定するラベル。なければnil
 	Condition   Expression
 	Consequence *BlockStatement
 }
 
 func (we *WhileExpression) expressionNode()      {}
 func (we *WhileExpression) TokenLiteral() string { return we.Token.Literal }
+func (we *WhileExpression) Pos() token.Position  { return we.Token.Pos }
 func (we *WhileExpression) String() string {
 	var out bytes.Buffer
 
+	out.WriteString(labelString(we.Label))
 	out.WriteString("WHILE")
 	out.WriteString(we.Condition.String())
 	out.WriteString(" ")
@@ -411,14 +524,20 @@ func (we *WhileExpression) String() string {
 type ClassLiteral struct {
 	Token   token.Token //'class'トークン
 	Name    string
+	Parent  Expression      //extendsで指定した親クラス。なければnil
+	Traits  []Expression    //implementsで指定したトレイト
 	Members []*LetStatement //識別子のスライス
 	Methods map[string]*FunctionStatement
-	Body    *BlockStatement
-	Block   *BlockStatement //mainly used for debugging purpose
+	//staticを付けたもの。インスタンスではなくクラスに1つだけある
+	StaticMembers []*LetStatement
+	StaticMethods map[string]*FunctionStatement
+	Body          *BlockStatement
+	Block         *BlockStatement //mainly used for debugging purpose
 }
 
 func (c *ClassLiteral) expressionNode()      {}
 func (c *ClassLiteral) TokenLiteral() string { return c.Token.Literal }
+func (c *ClassLiteral) Pos() token.Position  { return c.Token.Pos }
 
 func (c *ClassLiteral) String() string {
 	var out bytes.Buffer
@@ -433,6 +552,19 @@ func (c *ClassLiteral) String() string {
 	return out.String()
 }
 
+//クラス本体の static let x = 1; や static function f() {}
+type StaticStatement struct {
+	Token     token.Token //'static'トークン
+	Statement Statement   //*LetStatementか*FunctionStatement
+}
+
+func (s *StaticStatement) statementNode()       {}
+func (s *StaticStatement) TokenLiteral() string { return s.Token.Literal }
+func (s *StaticStatement) Pos() token.Position  { return s.Token.Pos }
+func (s *StaticStatement) String() string {
+	return s.Token.Literal + " " + s.Statement.String()
+}
+
 type ClassStatement struct {
 	Token        token.Token
 	Name         *Identifier //Class name
@@ -441,11 +573,22 @@ type ClassStatement struct {
 
 func (c *ClassStatement) statementNode()       {}
 func (c *ClassStatement) TokenLiteral() string { return c.Token.Literal }
+func (c *ClassStatement) Pos() token.Position  { return c.Token.Pos }
 func (c *ClassStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(c.Token.Literal + " ")
 	out.WriteString(c.Name.Value)
+	if c.ClassLiteral.Parent != nil {
+		out.WriteString(" extends " + c.ClassLiteral.Parent.String())
+	}
+	if len(c.ClassLiteral.Traits) > 0 {
+		traits := []string{}
+		for _, t := range c.ClassLiteral.Traits {
+			traits = append(traits, t.String())
+		}
+		out.WriteString(" implements " + strings.Join(traits, ", "))
+	}
 	out.WriteString("{ ")
 	out.WriteString(c.ClassLiteral.Block.String())
 	out.WriteString(" }")
@@ -453,21 +596,89 @@ func (c *ClassStatement) String() string {
 	return out.String()
 }
 
+//トレイトの本体のないメソッド。implementsしたクラスが実装しなければならない
+type MethodSignature struct {
+	Name       *Identifier
+	Parameters []*Identifier
+}
+
+func (m *MethodSignature) String() string {
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+	return "function " + m.Name.String() + "(" + strings.Join(params, ", ") + ");"
+}
+
+//trait文。クラスが持つべきメソッドと、その既定の実装を宣言する
+type TraitStatement struct {
+	Token    token.Token //'trait'トークン
+	Name     *Identifier
+	Required []*MethodSignature
+	Methods  []*FunctionStatement //既定の実装。クラスに同じ名前のメソッドがなければ使われる
+}
+
+func (t *TraitStatement) statementNode()       {}
+func (t *TraitStatement) TokenLiteral() string { return t.Token.Literal }
+func (t *TraitStatement) Pos() token.Position  { return t.Token.Pos }
+func (t *TraitStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(t.Token.Literal + " " + t.Name.String() + " { ")
+	for _, m := range t.Required {
+		out.WriteString(m.String() + " ")
+	}
+	for _, m := range t.Methods {
+		out.WriteString(m.String() + " ")
+	}
+	out.WriteString("}")
+
+	return out.String()
+}
+
+//メソッドの中で親クラスを指すsuper。super.method()やsuper(...)で使う
+type SuperExpression struct {
+	Token token.Token //'super'トークン
+}
+
+func (s *SuperExpression) expressionNode()      {}
+func (s *SuperExpression) TokenLiteral() string { return s.Token.Literal }
+func (s *SuperExpression) Pos() token.Position  { return s.Token.Pos }
+func (s *SuperExpression) String() string       { return s.Token.Literal }
+
+//メソッドを呼び出したインスタンスを指すthis
+type ThisExpression struct {
+	Token token.Token //'this'トークン
+}
+
+func (t *ThisExpression) expressionNode()      {}
+func (t *ThisExpression) TokenLiteral() string { return t.Token.Literal }
+func (t *ThisExpression) Pos() token.Position  { return t.Token.Pos }
+func (t *ThisExpression) String() string       { return t.Token.Literal }
+
 //newトークンとクラス
 type NewExpression struct {
-	Token token.Token //newToken
-	Class Expression  //class
+	Token     token.Token //newToken
+	Class     Expression  //class
+	Arguments []Expression
 }
 
 func (n *NewExpression) expressionNode()      {}
 func (n *NewExpression) TokenLiteral() string { return n.Token.Literal }
+func (n *NewExpression) Pos() token.Position  { return n.Token.Pos }
 func (n *NewExpression) String() string {
 	var out bytes.Buffer
 
+	args := []string{}
+	for _, a := range n.Arguments {
+		args = append(args, a.String())
+	}
+
 	out.WriteString(n.TokenLiteral() + " ")
 	out.WriteString(n.Class.String())
 	out.WriteString("(")
-	out.WriteString(") ")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
 
 	return out.String()
 }
@@ -481,6 +692,7 @@ type MethodCallExpression struct {
 
 func (mc *MethodCallExpression) expressionNode()      {}
 func (mc *MethodCallExpression) TokenLiteral() string { return mc.Token.Literal }
+func (mc *MethodCallExpression) Pos() token.Position  { return mc.Token.Pos }
 func (mc *MethodCallExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString(mc.Object.String())
@@ -492,6 +704,7 @@ func (mc *MethodCallExpression) String() string {
 
 type ForLoop struct {
 	Token  token.Token
+	Label  *Identifier //break/continueで指定するラベル。なければnil
 	Init   Expression
 	Cond   Expression
 	Update Expression
@@ -500,17 +713,25 @@ type ForLoop struct {
 
 func (fl *ForLoop) expressionNode()      {}
 func (fl *ForLoop) TokenLiteral() string { return fl.Token.Literal }
+func (fl *ForLoop) Pos() token.Position  { return fl.Token.Pos }
 
 func (fl *ForLoop) String() string {
 	var out bytes.Buffer
 
+	out.WriteString(labelString(fl.Label))
 	out.WriteString("for")
 	out.WriteString(" ( ")
-	out.WriteString(fl.Init.String())
+	if fl.Init != nil { //for (;;)のように省略されていることがある
+		out.WriteString(fl.Init.String())
+	}
 	out.WriteString(" ; ")
-	out.WriteString(fl.Cond.String())
+	if fl.Cond != nil {
+		out.WriteString(fl.Cond.String())
+	}
 	out.WriteString(" ; ")
-	out.WriteString(fl.Update.String())
+	if fl.Update != nil {
+		out.WriteString(fl.Update.String())
+	}
 	out.WriteString(" ) ")
 	out.WriteString(" { ")
 	out.WriteString(fl.Block.String())
@@ -519,6 +740,61 @@ func (fl *ForLoop) String() string {
 	return out.String()
 }
 
+//for (x in xs) { ... } または for (k, v in hash) { ... }
+type ForInExpression struct {
+	Token    token.Token //'for'トークン
+	Label    *Identifier //break/continueで指定するラベル。なければnil
+	Key      *Identifier //2つ目の変数がある場合の1つ目(インデックスやハッシュのキー)。なければnil
+	Value    *Identifier //要素が入る変数
+	Iterable Expression
+	Block    *BlockStatement
+}
+
+func (fi *ForInExpression) expressionNode()      {}
+func (fi *ForInExpression) TokenLiteral() string { return fi.Token.Literal }
+func (fi *ForInExpression) Pos() token.Position  { return fi.Token.Pos }
+
+func (fi *ForInExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(labelString(fi.Label))
+	out.WriteString("for (")
+	if fi.Key != nil {
+		out.WriteString(fi.Key.String())
+		out.WriteString(", ")
+	}
+	out.WriteString(fi.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fi.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fi.Block.String())
+
+	return out.String()
+}
+
+//範囲式 start..end (endは含まない)
+type RangeExpression struct {
+	Token token.Token //'..'トークン
+	Start Expression
+	End   Expression
+}
+
+func (re *RangeExpression) expressionNode()      {}
+func (re *RangeExpression) TokenLiteral() string { return re.Token.Literal }
+func (re *RangeExpression) Pos() token.Position  { return re.Token.Pos }
+
+func (re *RangeExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(re.Start.String())
+	out.WriteString("..")
+	out.WriteString(re.End.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 type AssignExpression struct {
 	Token token.Token
 	Name  Expression
@@ -527,13 +803,13 @@ type AssignExpression struct {
 
 func (ae *AssignExpression) expressionNode()      {}
 func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) Pos() token.Position  { return ae.Token.Pos }
 
 func (ae *AssignExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ae.Name.String())
-	out.WriteString(" = ")
-	out.WriteString(ae.Token.Literal)
+	out.WriteString(" " + ae.Token.Literal + " ")
 	out.WriteString(ae.Value.String())
 
 	return out.String()
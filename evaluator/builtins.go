@@ -2,7 +2,12 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	"monkey/object"
+	"sort"
+	"strconv"
+	"unicode/utf8"
 )
 
 var builtins = map[string]*object.Builtin{
@@ -20,7 +25,7 @@ var builtins = map[string]*object.Builtin{
 
 			//stringを受け取った時(きちんと動作する時)
 			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))} //goで文字列をlenし、IntegerObjectに渡してreturnしている。
+				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))} //バイト数ではなく文字数を数えて、IntegerObjectに渡してreturnしている。
 
 			//stringではない引数を受け取った時
 			default:
@@ -114,6 +119,157 @@ var builtins = map[string]*object.Builtin{
 			return newError("array to `pop` must be over 1 length, got %d", length)
 		},
 	},
+	"slice": &object.Builtin{ //slice(x, start, end) start番目からend番目の手前までを取り出す。文字列は文字単位
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 3 {
+				return newError("wrong number of arguments. got=%d,want=3", len(args))
+			}
+			for _, bound := range args[1:] {
+				if bound.Type() != object.INTEGER_OBJ {
+					return newError("argument to `slice` must be INTEGER, got %s", bound.Type())
+				}
+			}
+			//BigIntegerの添字は必ず範囲外
+			start, startOk := args[1].(*object.Integer)
+			end, endOk := args[2].(*object.Integer)
+			inRange := func(length int64) bool {
+				return startOk && endOk && start.Value >= 0 && end.Value <= length && start.Value <= end.Value
+			}
+
+			switch arg := args[0].(type) {
+			case *object.String:
+				runes := []rune(arg.Value)
+				if !inRange(int64(len(runes))) {
+					return newError("slice bounds out of range [%s:%s] with length %d",
+						args[1].Inspect(), args[2].Inspect(), len(runes))
+				}
+				return &object.String{Value: string(runes[start.Value:end.Value])}
+			case *object.Array:
+				length := int64(len(arg.Elements))
+				if !inRange(length) {
+					return newError("slice bounds out of range [%s:%s] with length %d",
+						args[1].Inspect(), args[2].Inspect(), length)
+				}
+				newElements := make([]object.Object, end.Value-start.Value)
+				copy(newElements, arg.Elements[start.Value:end.Value])
+				return &object.Array{Elements: newElements}
+			default:
+				return newError("argument to `slice` not supported, got=%s", args[0].Type())
+			}
+		},
+	},
+	"int": &object.Builtin{ //int(x) Floatは0方向に切り捨て、Stringは数値として読む
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d,want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *object.Integer, *object.BigInteger:
+				return arg
+			case *object.Float:
+				if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+					return newError("cannot convert %s to INTEGER", arg.Inspect())
+				}
+				if arg.Value >= math.MaxInt64 || arg.Value < math.MinInt64 {
+					value, _ := big.NewFloat(arg.Value).Int(nil)
+					return object.NewBigInteger(value)
+				}
+				return &object.Integer{Value: int64(arg.Value)}
+			case *object.String:
+				value, ok := new(big.Int).SetString(arg.Value, 0)
+				if !ok {
+					return newError("could not parse %q as integer", arg.Value)
+				}
+				return object.NewBigInteger(value)
+			default:
+				return newError("argument to `int` not supported, got=%s", args[0].Type())
+			}
+		},
+	},
+	"float": &object.Builtin{ //float(x) IntegerとStringをFloatにする
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d,want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *object.Integer:
+				return &object.Float{Value: float64(arg.Value)}
+			case *object.BigInteger:
+				value, _ := new(big.Float).SetInt(arg.Value).Float64()
+				return &object.Float{Value: value}
+			case *object.Float:
+				return arg
+			case *object.String:
+				value, err := strconv.ParseFloat(arg.Value, 64)
+				if err != nil {
+					return newError("could not parse %q as float", arg.Value)
+				}
+				return &object.Float{Value: value}
+			default:
+				return newError("argument to `float` not supported, got=%s", args[0].Type())
+			}
+		},
+	},
+	"str": &object.Builtin{ //str(x) 値を文字列にする(Inspectと同じ表示)
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d,want=1", len(args))
+			}
+			if str, ok := args[0].(*object.String); ok {
+				return str
+			}
+			return &object.String{Value: args[0].Inspect()}
+		},
+	},
+	"fields": &object.Builtin{ //fields(x) インスタンスのフィールド名の配列。クラスならstaticなフィールド名
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d,want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *object.Instance:
+				return stringArray(arg.Env.Names())
+			case *object.Class:
+				return stringArray(classMemberNames(arg, func(c *object.Class) []string { return c.Statics.Names() }))
+			default:
+				return newError("argument to `fields` must be INSTANCE or CLASS, got %s", args[0].Type())
+			}
+		},
+	},
+	"methods": &object.Builtin{ //methods(x) インスタンスのメソッド名の配列(親クラスのものも含む)。クラスならstaticなメソッド名
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d,want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *object.Instance:
+				return stringArray(classMemberNames(arg.Class, func(c *object.Class) []string { return functionNames(c.Methods) }))
+			case *object.Class:
+				return stringArray(classMemberNames(arg, func(c *object.Class) []string { return functionNames(c.StaticMethods) }))
+			default:
+				return newError("argument to `methods` must be INSTANCE or CLASS, got %s", args[0].Type())
+			}
+		},
+	},
+	"implements": &object.Builtin{ //implements(x, T) xのクラス(親クラスも含む)がトレイトTをimplementsしていればtrue
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d,want=2", len(args))
+			}
+			trait, ok := args[1].(*object.Trait)
+			if !ok {
+				return newError("second argument to `implements` must be TRAIT, got %s", args[1].Type())
+			}
+			switch arg := args[0].(type) {
+			case *object.Instance:
+				return nativeBoolToBooleanObject(classImplements(arg.Class, trait))
+			case *object.Class:
+				return nativeBoolToBooleanObject(classImplements(arg, trait))
+			default:
+				return FALSE
+			}
+		},
+	},
 	"puts": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			for _, args := range args {
@@ -123,3 +279,60 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 }
+
+//lenは__len__、strは__str__を持つインスタンスにも使える。
+//builtinsの初期化の中からメソッドを呼ぶ(Evalを参照する)と初期化が循環するので、ここで包み直す
+func init() {
+	str := builtins["str"].Fn
+	builtins["str"].Fn = func(args ...object.Object) object.Object {
+		if len(args) == 1 {
+			return stringify(args[0])
+		}
+		return str(args...)
+	}
+
+	length := builtins["len"].Fn
+	builtins["len"].Fn = func(args ...object.Object) object.Object {
+		if len(args) == 1 {
+			if result, ok := callSpecialMethod(args[0], "__len__"); ok {
+				if isError(result) || result.Type() == object.INTEGER_OBJ {
+					return result
+				}
+				return newError("__len__ must return INTEGER, got %s", result.Type())
+			}
+		}
+		return length(args...)
+	}
+}
+
+//clsと親クラスのそれぞれからnamesで名前を集め、重複を除いて並べる
+func classMemberNames(cls *object.Class, names func(*object.Class) []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for c := cls; c != nil; c = c.Parent {
+		for _, name := range names(c) {
+			if !seen[name] {
+				seen[name] = true
+				result = append(result, name)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func functionNames(fns map[string]*object.Function) []string {
+	names := make([]string, 0, len(fns))
+	for name := range fns {
+		names = append(names, name)
+	}
+	return names
+}
+
+func stringArray(strs []string) *object.Array {
+	elements := make([]object.Object, len(strs))
+	for i, s := range strs {
+		elements[i] = &object.String{Value: s}
+	}
+	return &object.Array{Elements: elements}
+}
@@ -1,9 +1,14 @@
 package evaluator
 
 import (
+	"bytes"
 	"fmt"
+	"math"
+	"math/big"
 	"monkey/ast"
 	"monkey/object"
+	"monkey/token"
+	"strings"
 )
 
 //真偽値用のインスタンスを予め作成しておく
@@ -13,7 +18,25 @@ var (
 	FALSE = &object.Boolean{Value: false}
 )
 
-func Eval(node ast.Node, env *object.Environment) object.Object {
+func init() {
+	object.InspectInstance = inspectInstance
+}
+
+//nodeを評価する。エラーが返る場合は、そのエラーが起きたノードの位置を付けておく
+//評価中にGoのpanicが起きた場合も、ホストごと落ちないようにエラーobjectにして返す
+func Eval(node ast.Node, env *object.Environment) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = newError("internal error: %v", r)
+		}
+		if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() && node != nil {
+			err.Pos = node.Pos() //一番内側(最初にエラーを返した)ノードの位置が入る
+		}
+	}()
+	return evalNode(node, env)
+}
+
+func evalNode(node ast.Node, env *object.Environment) object.Object {
 	//Nodeのタイプによってどのeval関数を呼び出すのか場合分け
 	switch node := node.(type) {
 
@@ -31,6 +54,14 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalWhileExpression(node, env)
 	case *ast.ForLoop:
 		return evalForLoopExpression(node, env)
+	case *ast.ForInExpression:
+		return evalForInExpression(node, env)
+	case *ast.RangeExpression:
+		return evalRangeExpression(node, env)
+	case *ast.BreakStatement:
+		return &object.Break{Label: labelName(node.Label)}
+	case *ast.ContinueStatement:
+		return &object.Continue{Label: labelName(node.Label)}
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
 		if isError(val) {
@@ -43,7 +74,14 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val) //環境に新しく変数を追加する。
+		if env.IsLocalConst(node.Name.Value) { //同じスコープのconstは宣言し直せない
+			return constError("cannot redeclare constant: %s", node.Name)
+		}
+		if node.IsConst() {
+			env.SetConst(node.Name.Value, val)
+		} else {
+			env.Set(node.Name.Value, val) //環境に新しく変数を追加する。
+		}
 	//識別子の場合
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
@@ -98,16 +136,27 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 	//式
 	case *ast.IntegerLiteral:
+		if node.Big != nil { //int64に収まらないリテラル
+			return &object.BigInteger{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value} //オブジェクトシステムの整数型を返す。Valueは受け取ったNodeのValueを入れている。
 
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value} //オブジェクトシステムの文字型を返す。Valueは受け取ったNodeのValueを入れている。
 
+	case *ast.InterpolatedString:
+		return evalInterpolatedString(node, env)
+
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value) //オブジェクトシステムの真偽値型を返す。Valueは受け取ったNodeのValueを入れている。
 
 	case *ast.ClassStatement:
 		return evalClassStatement(node, env)
+	case *ast.TraitStatement:
+		return evalTraitStatement(node, env)
 	case *ast.ClassLiteral:
 		return evalClassLiteral(node, env)
 	case *ast.NewExpression:
@@ -115,8 +164,15 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 	case *ast.MethodCallExpression:
 		return evalMethodCallExpression(node, env)
+	case *ast.SuperExpression:
+		return evalSuperExpression(node, env)
+	case *ast.ThisExpression:
+		return evalThisExpression(node, env)
 
 	case *ast.PrefixExpression: //前置演算式。Token(type),Operator(string),right(Expression)から成る
+		if node.Operator == "++" || node.Operator == "--" {
+			return evalIncDecExpression(node.Right, node.Operator, true, env)
+		}
 		right := Eval(node.Right, env) //まず右の式を評価してObjectを得る。
 		if isError(right) {
 			return right
@@ -124,6 +180,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalPrefixExpression(node.Operator, right) //オペレータと右の値(上で評価したObject)からObjectを返却する。
 
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" { //右辺を評価するかどうかは左辺次第
+			return evalLogicalExpression(node, env)
+		}
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
@@ -135,11 +194,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalInfixExpression(node.Operator, left, right)
 
 	case *ast.PostfixExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
-			return left
-		}
-		return evalPostfixExpression(left, node.Operator)
+		return evalIncDecExpression(node.Left, node.Operator, false, env)
 	case *ast.AssignExpression:
 		return evalAssignExpression(node, env)
 	}
@@ -155,6 +210,11 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean { //TrueとFalseの
 
 //前置演算子の評価関数
 func evalPrefixExpression(operator string, right object.Object) object.Object {
+	if operator == "-" { //-vは__neg__
+		if result, ok := callSpecialMethod(right, "__neg__"); ok {
+			return result
+		}
+	}
 	switch operator {
 	case "!":
 		return evalBangOperatorExpression(right) //right(右オペランド)の反転した値をValueに入れたobject.Objectを返却する
@@ -165,39 +225,36 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 	}
 }
 
-func evalPostfixExpression(left object.Object, operator string) object.Object {
-	switch operator {
-	case "++":
-		return evalIncrementPostfixOperatorExpression(left)
-	case "--":
-		return evalDecrementPostfixOperatorExpression(left)
-	default:
-		return newError("unknown operator: %s%s", operator, left.Type())
+//x++, ++x, x--, --x。値そのものは書き換えず、1足した(引いた)新しい値を代入し直す。
+//前置は新しい値、後置は元の値を返す
+func evalIncDecExpression(target ast.Expression, operator string, prefix bool, env *object.Environment) object.Object {
+	lv, errObj := evalLvalue(target, env)
+	if errObj != nil {
+		return errObj
+	}
+	old := lv.get()
+	if isError(old) {
+		return old
+	}
+	if !isNumber(old) {
+		if prefix {
+			return newError("unknown operator: %s%s", operator, old.Type())
+		}
+		return newError("unknown operator: %s%s", old.Type(), operator)
 	}
-}
 
-func evalIncrementPostfixOperatorExpression(left object.Object) object.Object {
-	switch left.Type() {
-	case object.INTEGER_OBJ: //Integerのみ後置演算のみ
-		leftObj := left.(*object.Integer)
-		returnVal := object.NewInteger(leftObj.Value)
-		leftObj.Value = leftObj.Value + 1
-		return returnVal
-	default:
-		return NULL
+	updated := evalInfixExpression(operator[:1], old, &object.Integer{Value: 1})
+	if isError(updated) {
+		return updated
+	}
+	if result := lv.set(updated); isError(result) {
+		return result
 	}
-}
 
-func evalDecrementPostfixOperatorExpression(left object.Object) object.Object {
-	switch left.Type() {
-	case object.INTEGER_OBJ: //Integerのみ後置演算のみ
-		leftObj := left.(*object.Integer)
-		returnVal := object.NewInteger(leftObj.Value)
-		leftObj.Value = leftObj.Value - 1
-		return returnVal
-	default:
-		return NULL
+	if prefix {
+		return updated
 	}
+	return old
 }
 
 //right(右オペランド)の反転した値を返却する。
@@ -217,19 +274,38 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 
 //前置演算子-の処理
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ { //オペランドが整数かどうかのcheck
+	switch right := right.(type) { //オペランドが数値かどうかのcheck
+	case *object.Integer:
+		if right.Value == math.MinInt64 { //-MinInt64はint64に収まらない
+			return object.NewBigInteger(new(big.Int).Neg(big.NewInt(right.Value)))
+		}
+		return &object.Integer{Value: -right.Value} //-1がかかった値を返却する
+	case *object.BigInteger:
+		return object.NewBigInteger(new(big.Int).Neg(right.Value))
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value} //-1がかかった値を返却する
 }
 
 func evalInfixExpression(operator string, left, right object.Object) object.Object {
+	if result, ok := evalOperatorMethod(operator, left, right); ok {
+		return result
+	}
+
 	switch {
+	case operator == "instanceof":
+		return evalInstanceOfExpression(left, right)
+
 	//オペランド(演算対象)として、整数値が入れられた場合
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
 
+	//片方でもFloatが入っている場合は、両方Floatに揃えて計算する
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
+
 	//オペランドとして、真偽値が入れられた場合
 	case operator == "==":
 		return nativeBoolToBooleanObject(left == right)
@@ -249,23 +325,56 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 }
 
 //中値演算子式。オペランドとして整数が入れられた場合。
+//int64で桁あふれする場合は多倍長整数(BigInteger)で計算し直す
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
+	leftObj, leftOk := left.(*object.Integer)
+	rightObj, rightOk := right.(*object.Integer)
+	if !leftOk || !rightOk {
+		return evalBigIntegerInfixExpression(operator, left, right)
+	}
+	leftVal := leftObj.Value
+	rightVal := rightObj.Value
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		sum := leftVal + rightVal
+		if (rightVal > 0 && sum < leftVal) || (rightVal < 0 && sum > leftVal) {
+			return evalBigIntegerInfixExpression(operator, left, right)
+		}
+		return &object.Integer{Value: sum}
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		diff := leftVal - rightVal
+		if (rightVal > 0 && diff > leftVal) || (rightVal < 0 && diff < leftVal) {
+			return evalBigIntegerInfixExpression(operator, left, right)
+		}
+		return &object.Integer{Value: diff}
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		product := leftVal * rightVal
+		if leftVal != 0 && (product/leftVal != rightVal || (leftVal == -1 && rightVal == math.MinInt64)) {
+			return evalBigIntegerInfixExpression(operator, left, right)
+		}
+		return &object.Integer{Value: product}
 	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		if leftVal == math.MinInt64 && rightVal == -1 { //-MinInt64はint64に収まらない
+			return evalBigIntegerInfixExpression(operator, left, right)
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("modulo by zero")
+		}
+		return &object.Integer{Value: leftVal % rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
@@ -276,6 +385,145 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	}
 }
 
+//中値演算子式。どちらかがBigIntegerの場合か、int64で桁あふれした場合。
+//結果がint64に収まれば*object.Integerに戻す
+func evalBigIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toBigInt(left)
+	rightVal := toBigInt(right)
+
+	if rightVal.Sign() == 0 {
+		switch operator {
+		case "/":
+			return newError("division by zero")
+		case "%":
+			return newError("modulo by zero")
+		}
+	}
+
+	switch operator {
+	case "+":
+		return object.NewBigInteger(new(big.Int).Add(leftVal, rightVal))
+	case "-":
+		return object.NewBigInteger(new(big.Int).Sub(leftVal, rightVal))
+	case "*":
+		return object.NewBigInteger(new(big.Int).Mul(leftVal, rightVal))
+	case "/":
+		return object.NewBigInteger(new(big.Int).Quo(leftVal, rightVal)) //int64の/と同じく0方向に切り捨て
+	case "%":
+		return object.NewBigInteger(new(big.Int).Rem(leftVal, rightVal)) //符号は左辺と同じ(int64の%と同じ)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) >= 0)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) != 0)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+//整数objectを*big.Intとして取り出す。BigIntegerの値は共有しているので書き換えないこと
+func toBigInt(obj object.Object) *big.Int {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return big.NewInt(obj.Value)
+	case *object.BigInteger:
+		return obj.Value
+	}
+	return new(big.Int)
+}
+
+//中値演算子式。オペランドのどちらかがFloatの場合。Integerはfloat64に変換してから計算する
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toFloat64(left)
+	rightVal := toFloat64(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 { //整数と同じく、InfやNaNにはせずエラーにする
+			return newError("division by zero")
+		}
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("modulo by zero")
+		}
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+//IntegerかFloatかどうか
+func isNumber(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Integer, *object.BigInteger, *object.Float:
+		return true
+	}
+	return false
+}
+
+//数値objectをfloat64として取り出す
+func toFloat64(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInteger:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f
+	case *object.Float:
+		return obj.Value
+	}
+	return 0
+}
+
+//&&と||。左辺だけで結果が決まる場合は右辺を評価しない(短絡評価)
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	if node.Operator == "&&" && !isTruthy(left) {
+		return FALSE
+	}
+	if node.Operator == "||" && isTruthy(left) {
+		return TRUE
+	}
+
+	right := Eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(ie.Condition, env)
 	if isError(condition) {
@@ -316,6 +564,8 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 			return result.Value
 		case *object.Error: //errorの時、評価を中断する
 			return result
+		case *object.Break, *object.Continue: //構文解析で弾いているので、通常はここまで来ない
+			return newError("%s outside loop", result.Inspect())
 		}
 	}
 	return result
@@ -332,6 +582,9 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ { //returnとerrorの時の両方で評価を中断する
 				return result
 			}
+			if rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ { //break/continueはループまで戻る
+				return result
+			}
 		}
 	}
 	return result
@@ -384,11 +637,27 @@ func evalExpressions(
 func applyFunction(fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+		}
 		extendEnv := extendFunctionEnv(fn, args) //関数が保持する環境に包まれた新環境で変数を束縛し、その環境を返す。
 		evaluated := Eval(fn.Body, extendEnv)    //その関数のBodyと環境を入れ、Evalする！
 		return unwrapReturnValue(evaluated)      //returnの場合、アンラップしないとBlockの外まできて評価を中止してしまう。
 	case *object.Builtin:
 		return fn.Fn(args...)
+	case *object.BoundMethod:
+		if len(args) != len(fn.Method.Parameters) {
+			return newError("wrong number of arguments to %s.%s: want=%d, got=%d",
+				fn.Owner.Name, fn.Name, len(fn.Method.Parameters), len(args))
+		}
+		return applyFunction(methodFunction(fn), args)
+	case *object.Instance: //__call__を持つインスタンスは関数のように呼べる
+		if result, ok := callSpecialMethod(fn, "__call__", args...); ok {
+			return result
+		}
+		return newError("not a function: %s", fn.Type())
+	case *object.Super: //super(...)で親クラスのコンストラクタを呼ぶ
+		return callConstructor(fn.Instance, fn.Class, args)
 	default: //objectが手に入っていない場合はエラーを発生
 		return newError("not a function: %s", fn.Type())
 	}
@@ -409,8 +678,11 @@ func extendFunctionEnv(
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
-	if returnValue, ok := obj.(*object.ReturnValue); ok {
-		return returnValue.Value
+	switch obj := obj.(type) {
+	case *object.ReturnValue:
+		return obj.Value
+	case *object.Break, *object.Continue: //関数の外のループは抜けられない
+		return newError("%s outside loop", obj.Inspect())
 	}
 	return obj
 }
@@ -430,10 +702,39 @@ func evalStringInfixExpression(
 	return &object.String{Value: leftVal + rightVal}
 }
 
+//埋め込み式を現在の環境で評価し、str()と同じように文字列にしてつなげる
+func evalInterpolatedString(node *ast.InterpolatedString, env *object.Environment) object.Object {
+	var out bytes.Buffer
+
+	for _, part := range node.Parts {
+		if str, ok := part.(*ast.StringLiteral); ok {
+			out.WriteString(str.Value)
+			continue
+		}
+		val := Eval(part, env)
+		if isError(val) {
+			return val
+		}
+		if val != nil {
+			str := stringify(val)
+			if isError(str) {
+				return str
+			}
+			out.WriteString(str.Inspect())
+		}
+	}
+	return &object.String{Value: out.String()}
+}
+
 func evalIndexExpression(left, index object.Object) object.Object {
+	if result, ok := callSpecialMethod(left, "__getitem__", index); ok {
+		return result
+	}
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
@@ -443,7 +744,11 @@ func evalIndexExpression(left, index object.Object) object.Object {
 
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
+	intIndex, ok := index.(*object.Integer)
+	if !ok { //BigIntegerの添字は必ず範囲外
+		return NULL
+	}
+	idx := intIndex.Value
 	max := int64(len(arrayObject.Elements) - 1)
 
 	if idx < 0 || idx > max { //配列の長さが0未満、maxより大きい場合
@@ -452,6 +757,22 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrayObject.Elements[idx]
 }
 
+//文字列の添字はバイトではなく文字(rune)単位
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	runes := []rune(str.(*object.String).Value)
+	intIndex, ok := index.(*object.Integer)
+	if !ok { //BigIntegerの添字は必ず範囲外
+		return NULL
+	}
+	idx := intIndex.Value
+	max := int64(len(runes) - 1)
+
+	if idx < 0 || idx > max {
+		return NULL
+	}
+	return &object.String{Value: string(runes[idx])}
+}
+
 func evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
@@ -498,16 +819,28 @@ func evalWhileExpression(
 	we *ast.WhileExpression,
 	env *object.Environment,
 ) object.Object {
-	condition := Eval(we.Condition, env)
-	if isError(condition) {
-		return condition
-	}
+	//再帰せずに回すので、繰り返しの回数が多くてもGoのスタックは増えない。
+	//forと同じく、最後に完了した本体の値を結果にする(breakで抜けた場合も)。一度も実行しなければNULL
+	var result object.Object = NULL
+	for {
+		condition := Eval(we.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return result
+		}
 
-	if isTruthy(condition) {
-		Eval(we.Consequence, env)
-		return Eval(we, env) //真文
+		body := Eval(we.Consequence, env)
+		switch loopControl(body, we.Label) {
+		case loopBreak:
+			return result
+		case loopExit: //returnやerrorはループの外へ伝える
+			return body
+		case loopNext:
+			result = body
+		}
 	}
-	return NULL
 }
 
 func evalClassLiteral(c *ast.ClassLiteral, env *object.Environment) object.Object {
@@ -515,110 +848,669 @@ func evalClassLiteral(c *ast.ClassLiteral, env *object.Environment) object.Objec
 		Name:    c.Name,
 		Members: c.Members,
 		Methods: make(map[string]*object.Function, len(c.Methods)),
+
+		StaticMethods: make(map[string]*object.Function, len(c.StaticMethods)),
 	}
 
-	newScope := object.NewEnclosedEnvironment(env)
+	if c.Parent != nil { //extendsした親クラス
+		parent := Eval(c.Parent, env)
+		if isError(parent) {
+			return parent
+		}
+		parentCls, ok := parent.(*object.Class)
+		if !ok {
+			return newError("cannot extend %s", parent.Type())
+		}
+		clsObj.Parent = parentCls
+	}
+
+	for _, t := range c.Traits { //implementsしたトレイト
+		obj := Eval(t, env)
+		if isError(obj) {
+			return obj
+		}
+		trait, ok := obj.(*object.Trait)
+		if !ok {
+			return newError("cannot implement %s", obj.Type())
+		}
+		clsObj.Traits = append(clsObj.Traits, trait)
+	}
+
+	//staticなものはクラスを作る時に1回だけ評価する。
+	//インスタンスの環境はこの内側にできるので、メソッドからも名前だけで読み書きできる。
+	//外側には親クラスのstaticなメンバーを置き、C.xと同じように親のものも名前だけで使えるようにする
+	outer := env
+	if clsObj.Parent != nil {
+		outer = staticScope(clsObj.Parent, env)
+	}
+	staticMethods := object.NewEnclosedEnvironment(outer) //fieldsに出ないよう、フィールドとは別の環境に入れる
+	statics := object.NewEnclosedEnvironment(staticMethods)
+	for k, f := range c.StaticMethods {
+		clsObj.StaticMethods[k] = Eval(f.FunctionLiteral, statics).(*object.Function)
+		staticMethods.Set(k, clsObj.StaticMethods[k])
+	}
+	for _, member := range c.StaticMembers {
+		if val := Eval(member, statics); isError(val) {
+			return val
+		}
+	}
+	clsObj.Statics = statics
+
+	newScope := object.NewEnclosedEnvironment(statics)
 	for _, member := range c.Members {
 		Eval(member, newScope) //拡張環境先で変数を入れる。
 	}
 	for k, f := range c.Methods {
-		clsObj.Methods[k] = Eval(f, newScope).(*object.Function)
+		clsObj.Methods[k] = Eval(f.FunctionLiteral, newScope).(*object.Function) //メソッドの名前はメソッドを呼ぶ時にthisに結びつけて入れる
 	}
+	clsObj.Env = newScope
 
+	if err := applyTraits(clsObj); err != nil {
+		return err
+	}
 	return clsObj
 }
 
+//トレイトの既定の実装をクラスに足してから、実装が必要なメソッドが揃っているか確かめる。
+//親クラスから受け継いだメソッドでもよい
+func applyTraits(cls *object.Class) *object.Error {
+	for _, trait := range cls.Traits {
+		for name, f := range trait.Methods {
+			if m, _ := findMethod(cls, name); m == nil {
+				cls.Methods[name] = f
+			}
+		}
+	}
+	for _, trait := range cls.Traits {
+		for _, required := range trait.Required {
+			name := required.Name.Value
+			m, _ := findMethod(cls, name)
+			if m == nil {
+				return newError("class %s does not implement %s.%s", cls.Name, trait.Name, name)
+			}
+			if len(m.Parameters) != len(required.Parameters) {
+				return newError("%s.%s must take %d arguments to implement %s, got %d",
+					cls.Name, name, len(required.Parameters), trait.Name, len(m.Parameters))
+			}
+		}
+	}
+	return nil
+}
+
+//clsかその親クラスがtraitをimplementsしているかどうか
+func classImplements(cls *object.Class, trait *object.Trait) bool {
+	for c := cls; c != nil; c = c.Parent {
+		for _, t := range c.Traits {
+			if t == trait {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func evalTraitStatement(t *ast.TraitStatement, env *object.Environment) object.Object {
+	trait := &object.Trait{
+		Name:     t.Name.Value,
+		Required: t.Required,
+		Methods:  make(map[string]*object.Function, len(t.Methods)),
+	}
+	for _, f := range t.Methods {
+		trait.Methods[f.Name.Value] = Eval(f.FunctionLiteral, env).(*object.Function)
+	}
+
+	env.Set(t.Name.Value, trait)
+
+	return NULL
+}
+
 func evalClassStatement(c *ast.ClassStatement, env *object.Environment) object.Object {
 
 	clsObj := evalClassLiteral(c.ClassLiteral, env)
+	if isError(clsObj) {
+		return clsObj
+	}
 
 	env.Set(c.Name.Value, clsObj) //環境にセットする
 
 	return NULL
 }
 
+//コンストラクタのメソッド名
+const constructorName = "init"
+
 func evalNewExpression(n *ast.NewExpression, env *object.Environment) object.Object {
 	class := Eval(n.Class, env) //そもそもクラス文ってExpressionなのか？
+	if isError(class) {
+		return class
+	}
 
 	clsObj, ok := class.(*object.Class)
 	if !ok {
-		fmt.Println("error2")
+		return newError("not a class: %s", class.Type())
 	}
-	newScope := object.NewEnclosedEnvironment(env)
-	for _, member := range clsObj.Members {
-		Eval(member, newScope)
-	}
-	for k, f := range clsObj.Methods {
-		newScope.Set(k, f)
+
+	args := evalExpressions(n.Arguments, env) //引数はnewを書いた場所の環境で評価する
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
 	}
 
-	instance := &object.Instance{Class: clsObj, Env: newScope} //閉じた環境にclsObjを入れる。
+	//インスタンスの環境はクラスを定義した環境の内側に作る
+	instance := &object.Instance{Class: clsObj, Env: object.NewEnclosedEnvironment(clsObj.Env)}
 
+	//インスタンスの環境に入れるのはフィールドだけ。メソッドは呼ぶ時にクラスから探す。
+	//親クラスから順に入れるので、子クラスの同じ名前が後から上書きする。
+	//初期化の式は、そのフィールドを定義したクラスのスコープで評価する
+	for _, cls := range classChain(clsObj) {
+		scope := instance.Env.WithOuter(cls.Env)
+		for _, member := range cls.Members {
+			if val := Eval(member, scope); isError(val) {
+				return val
+			}
+		}
+	}
+
+	if result := callConstructor(instance, clsObj, args); isError(result) {
+		return result
+	}
 	return instance
 }
 
+//一番上の親クラスからclsまでを順に並べる
+func classChain(cls *object.Class) []*object.Class {
+	var chain []*object.Class
+	for c := cls; c != nil; c = c.Parent {
+		chain = append([]*object.Class{c}, chain...)
+	}
+	return chain
+}
+
+//clsから親の方へたどってメソッドを探す。見つかったメソッドと、それを定義したクラスを返す
+func findMethod(cls *object.Class, name string) (*object.Function, *object.Class) {
+	for c := cls; c != nil; c = c.Parent {
+		if f, ok := c.Methods[name]; ok {
+			return f, c
+		}
+	}
+	return nil, nil
+}
+
+//メソッドをインスタンスに結びつける
+func bindMethod(instance *object.Instance, owner *object.Class, name string, f *object.Function) *object.BoundMethod {
+	return &object.BoundMethod{Receiver: instance, Owner: owner, Name: name, Method: f}
+}
+
+//結びついたメソッドを呼ぶ関数にする。呼ぶたびにインスタンスの環境の内側に新しい環境を作り、
+//thisにインスタンス、親クラスがあればsuperに定義したクラスの親を入れる
+func methodFunction(bm *object.BoundMethod) *object.Function {
+	//フィールドの外側に、インスタンスに結びつけたメソッドを置く。this.b()と同じように名前だけのb()でも呼べる。
+	//その外側は、メソッドを定義した場所のスコープ(クラスのstaticや、クラスやトレイトを定義した場所の変数)
+	methods := object.NewEnclosedEnvironment(bm.Method.Env)
+	for _, cls := range classChain(bm.Receiver.Class) {
+		for name, f := range cls.Methods {
+			methods.Set(name, bindMethod(bm.Receiver, cls, name, f))
+		}
+	}
+	env := object.NewEnclosedEnvironment(bm.Receiver.Env.WithOuter(methods))
+	env.Set("this", bm.Receiver)
+	if bm.Owner.Parent != nil {
+		env.Set("super", &object.Super{Instance: bm.Receiver, Class: bm.Owner.Parent})
+	}
+	return &object.Function{Parameters: bm.Method.Parameters, Body: bm.Method.Body, Env: env}
+}
+
+//clsから親の方へたどってinitを探し、instanceに対して呼ぶ。initがどこにもなければ引数は受け取れない
+func callConstructor(instance *object.Instance, cls *object.Class, args []object.Object) object.Object {
+	initFn, owner := findMethod(cls, constructorName)
+	if initFn == nil {
+		if len(args) != 0 {
+			return newError("wrong number of arguments to new %s: want=0, got=%d", cls.Name, len(args))
+		}
+		return NULL
+	}
+
+	if result := applyFunction(bindMethod(instance, owner, constructorName, initFn), args); isError(result) {
+		return result
+	}
+	return NULL
+}
+
+func evalSuperExpression(s *ast.SuperExpression, env *object.Environment) object.Object {
+	if sup, ok := env.Get("super"); ok {
+		return sup
+	}
+	return newError("super used outside of a subclass method")
+}
+
+func evalThisExpression(t *ast.ThisExpression, env *object.Environment) object.Object {
+	if this, ok := env.Get("this"); ok {
+		return this
+	}
+	return newError("this used outside of a method")
+}
+
+//clsとその親クラスのstaticなフィールドとメソッドを、outerの内側から名前だけで見えるようにした環境を返す。
+//子クラスのものほど内側に置くので、同じ名前なら子クラスのものが見える
+func staticScope(cls *object.Class, outer *object.Environment) *object.Environment {
+	for _, c := range classChain(cls) {
+		methods := object.NewEnclosedEnvironment(outer)
+		for name, f := range c.StaticMethods {
+			methods.Set(name, f)
+		}
+		outer = c.Statics.WithOuter(methods)
+	}
+	return outer
+}
+
+//clsから親の方へたどってstaticなメンバーを探す。フィールドならそれを持つクラスも返す
+func findStatic(cls *object.Class, name string) (object.Object, *object.Class) {
+	for c := cls; c != nil; c = c.Parent {
+		if f, ok := c.StaticMethods[name]; ok {
+			return f, nil
+		}
+		if val, ok := c.Statics.GetLocal(name); ok {
+			return val, c
+		}
+	}
+	return nil, nil
+}
+
+//演算子をオーバーロードする特殊メソッドの名前。左のオペランドのメソッドを呼ぶ
+var operatorMethods = map[string]string{
+	"+": "__add__",
+	"-": "__sub__",
+	"*": "__mul__",
+	"/": "__div__",
+}
+
+//インスタンスの特殊メソッドで演算子を計算する。使えるメソッドがなければokはfalse。
+//!=は__eq__の否定、>と<=は左右を入れ替えた__lt__、>=は__lt__の否定にする。
+//==と!=は左が__eq__を持たなければ右の__eq__を使う。
+//比較で入れ替えた側がインスタンスでなければ、もう一方の__lt__と__eq__から求める
+func evalOperatorMethod(operator string, left, right object.Object) (result object.Object, ok bool) {
+	switch operator {
+	case "==":
+		if result, ok := callSpecialMethod(left, "__eq__", right); ok {
+			return result, ok
+		}
+		return callSpecialMethod(right, "__eq__", left)
+	case "!=":
+		if result, ok := negate(callSpecialMethod(left, "__eq__", right)); ok {
+			return result, ok
+		}
+		return negate(callSpecialMethod(right, "__eq__", left))
+	case "<":
+		if result, ok := callSpecialMethod(left, "__lt__", right); ok {
+			return result, ok
+		}
+		return greaterThan(right, left)
+	case ">":
+		if result, ok := callSpecialMethod(right, "__lt__", left); ok {
+			return result, ok
+		}
+		return greaterThan(left, right)
+	case "<=":
+		if result, ok := negate(callSpecialMethod(right, "__lt__", left)); ok {
+			return result, ok
+		}
+		return lessOrEqual(left, right)
+	case ">=":
+		if result, ok := negate(callSpecialMethod(left, "__lt__", right)); ok {
+			return result, ok
+		}
+		return lessOrEqual(right, left)
+	}
+	if name, ok := operatorMethods[operator]; ok {
+		return callSpecialMethod(left, name, right)
+	}
+	return nil, false
+}
+
+func negate(result object.Object, ok bool) (object.Object, bool) {
+	if !ok || isError(result) {
+		return result, ok
+	}
+	return nativeBoolToBooleanObject(!isTruthy(result)), true
+}
+
+//aの__lt__と__eq__で a > b を求める。a > b は !(a < b) && !(a == b)
+func greaterThan(a, b object.Object) (object.Object, bool) {
+	lt, ok := callSpecialMethod(a, "__lt__", b)
+	if !ok || isError(lt) {
+		return lt, ok
+	}
+	if isTruthy(lt) {
+		return FALSE, true
+	}
+	return negate(equalTo(a, b), true)
+}
+
+//aの__lt__と__eq__で a <= b を求める。a <= b は a < b || a == b
+func lessOrEqual(a, b object.Object) (object.Object, bool) {
+	lt, ok := callSpecialMethod(a, "__lt__", b)
+	if !ok || isError(lt) {
+		return lt, ok
+	}
+	if isTruthy(lt) {
+		return TRUE, true
+	}
+	eq := equalTo(a, b)
+	if isError(eq) {
+		return eq, true
+	}
+	return nativeBoolToBooleanObject(isTruthy(eq)), true
+}
+
+//aの__eq__で a == b を求める。__eq__がなければ==と同じく同じobjectかどうか
+func equalTo(a, b object.Object) object.Object {
+	if result, ok := callSpecialMethod(a, "__eq__", b); ok {
+		return result
+	}
+	return nativeBoolToBooleanObject(a == b)
+}
+
+//receiverがnameの特殊メソッドを持つインスタンスなら、それを呼んで結果を返す。持たなければokはfalse
+func callSpecialMethod(receiver object.Object, name string, args ...object.Object) (result object.Object, ok bool) {
+	instance, isInstance := receiver.(*object.Instance)
+	if !isInstance {
+		return nil, false
+	}
+	f, owner := findMethod(instance.Class, name)
+	if f == nil {
+		return nil, false
+	}
+	return applyFunction(bindMethod(instance, owner, name, f), args), true
+}
+
+//__str__の結果をインスタンスの表示にする。エラーや文字列以外を返したら既定の表示のまま。
+//Inspectはエラーを返せないため。str()や文字列への埋め込みではstringifyがエラーにする
+func inspectInstance(instance *object.Instance) (string, bool) {
+	result, ok := callSpecialMethod(instance, "__str__")
+	if !ok {
+		return "", false
+	}
+	str, ok := result.(*object.String)
+	if !ok {
+		return "", false
+	}
+	return str.Value, true
+}
+
+//valを文字列にする。__str__を持つインスタンスならそれを呼び、エラーや文字列以外を返したらエラーにする
+func stringify(val object.Object) object.Object {
+	if result, ok := callSpecialMethod(val, "__str__"); ok {
+		if isError(result) || result.Type() == object.STRING_OBJ {
+			return result
+		}
+		return newError("__str__ must return STRING, got %s", result.Type())
+	}
+	if str, ok := val.(*object.String); ok {
+		return str
+	}
+	return &object.String{Value: val.Inspect()}
+}
+
+//x instanceof C。xのクラスかその親のどれかがCならtrue
+func evalInstanceOfExpression(left, right object.Object) object.Object {
+	cls, ok := right.(*object.Class)
+	if !ok {
+		return newError("right-hand side of instanceof must be a class, got %s", right.Type())
+	}
+	instance, ok := left.(*object.Instance)
+	if !ok {
+		return FALSE
+	}
+	for c := instance.Class; c != nil; c = c.Parent {
+		if c == cls {
+			return TRUE
+		}
+	}
+	return FALSE
+}
+
 func evalMethodCallExpression(call *ast.MethodCallExpression, env *object.Environment) object.Object {
 	obj := Eval(call.Object, env)
 	if obj.Type() == object.ERROR_OBJ {
 		return obj
 	}
-	switch m := obj.(type) {
-	case *object.Instance: //.の左側のtype
-		instanceObj := m
-		switch o := call.Call.(type) { //.の右側のtype
-		case *ast.Identifier:
-			val, ok := instanceObj.Env.Get(o.Value)
-			if ok {
-				return val
-			}
-		case *ast.CallExpression:
-			return Eval(o, instanceObj.Env)
+
+	var name string //.の右側の名前
+	var argExps []ast.Expression
+	switch o := call.Call.(type) { //.の右側のtype
+	case *ast.Identifier:
+		name = o.Value
+	case *ast.CallExpression:
+		ident, ok := o.Function.(*ast.Identifier)
+		if !ok {
+			return newError("cannot call %s", o.Function.String())
 		}
+		name, argExps = ident.Value, o.Arguments
+	default:
+		return NULL
 	}
-	return NULL
+
+	var member object.Object
+	switch m := obj.(type) { //.の左側のtype
+	case *object.Instance:
+		if val, ok := m.Env.GetLocal(name); ok { //フィールドが先。親クラスのフィールドもnewの時にインスタンスに入っている
+			member = val
+		} else if f, owner := findMethod(m.Class, name); f != nil {
+			member = bindMethod(m, owner, name, f)
+		} else {
+			return newError("undefined field or method: %s", name)
+		}
+	case *object.Super: //super.method()は親クラスから探す
+		f, owner := findMethod(m.Class, name)
+		if f == nil {
+			return newError("undefined method %s in %s", name, m.Class.Name)
+		}
+		member = bindMethod(m.Instance, owner, name, f)
+	case *object.Class: //Class.memberはstaticなものだけ
+		val, _ := findStatic(m, name)
+		if val == nil {
+			return newError("undefined static member %s on %s", name, m.Name)
+		}
+		member = val
+	default: //文字列や配列などは型ごとのメソッド表から探す
+		member = lookupTypeMethod(obj, name)
+		if isError(member) {
+			return member
+		}
+	}
+
+	if _, ok := call.Call.(*ast.CallExpression); !ok {
+		return member
+	}
+	args := evalExpressions(argExps, env) //引数は呼び出した場所の環境で評価する
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+	return applyFunction(member, args)
 }
 
+//x = v と x += v などの複合代入
 func evalAssignExpression(a *ast.AssignExpression, env *object.Environment) object.Object {
+	lv, errObj := evalLvalue(a.Name, env) //a[f()] += 1 でもf()は1回だけ呼ばれる
+	if errObj != nil {
+		return errObj
+	}
+
 	val := Eval(a.Value, env)
 	if val.Type() == object.ERROR_OBJ {
 		return val
 	}
 
-	var name string
-	switch nodeType := a.Name.(type) {
+	if a.Token.Type != token.ASSIGN { //+= なら今の値 + val を代入する
+		old := lv.get()
+		if isError(old) {
+			return old
+		}
+		operator := strings.TrimSuffix(a.Token.Literal, "=")
+		val = evalInfixExpression(operator, old, val)
+		if isError(val) {
+			return val
+		}
+	}
+	return lv.set(val)
+}
+
+//constへの代入のエラー。代入式全体ではなく、変数名の位置を指す
+func constError(format string, name *ast.Identifier) *object.Error {
+	err := newError(format, name.Value)
+	err.Pos = name.Pos()
+	return err
+}
+
+//代入できる場所。変数、配列の要素、ハッシュの値、インスタンスのフィールドのどれか
+type lvalue struct {
+	get func() object.Object              //今の値。読めない場合はerror
+	set func(object.Object) object.Object //値を書き込む。書き込めない場合はerror
+}
+
+//代入先の式を評価して、読み書きできる場所にする。a[i]のaとiはここで1回だけ評価する
+func evalLvalue(target ast.Expression, env *object.Environment) (*lvalue, object.Object) {
+	switch target := target.(type) {
 	case *ast.Identifier:
-		name = nodeType.Value
+		name := target.Value
+		return &lvalue{
+			get: func() object.Object {
+				return evalIdentifier(target, env)
+			},
+			set: func(val object.Object) object.Object {
+				if env.IsConst(name) {
+					return constError("cannot assign to constant: %s", target)
+				}
+				v, ok := env.Reset(name, val)
+				if !ok { //新しい変数はletで宣言する
+					return newError("assignment to undeclared variable: %s", name)
+				}
+				return v
+			},
+		}, nil
 	case *ast.IndexExpression:
-		name = nodeType.Left.(*ast.Identifier).Value
+		left := Eval(target.Left, env)
+		if isError(left) {
+			return nil, left
+		}
+		index := Eval(target.Index, env)
+		if isError(index) {
+			return nil, index
+		}
+		return &lvalue{
+			get: func() object.Object {
+				return evalIndexExpression(left, index)
+			},
+			set: func(val object.Object) object.Object {
+				return assignIndex(left, index, val)
+			},
+		}, nil
+	case *ast.MethodCallExpression:
+		field, ok := target.Call.(*ast.Identifier)
+		if !ok {
+			return nil, newError("cannot assign to %s", target.String())
+		}
+		obj := Eval(target.Object, env)
+		if isError(obj) {
+			return nil, obj
+		}
+		switch obj := obj.(type) {
+		case *object.Instance:
+			return fieldLvalue(obj.Env, field), nil //そのインスタンスのフィールドだけを書き換える
+		case *object.Class: //Class.x = v はstaticなフィールドを書き換える。全てのインスタンスから見える
+			if _, owner := findStatic(obj, field.Value); owner != nil {
+				return fieldLvalue(owner.Statics, field), nil
+			}
+			return nil, newError("undefined static field %s on %s", field.Value, obj.Name)
+		default:
+			return nil, newError("cannot assign field %s on %s", field.Value, obj.Type())
+		}
+	default:
+		return nil, newError("cannot assign to %s", target.String())
 	}
-	v, ok := env.Reset(name, val)
-	if ok {
-		return v
+}
+
+//インスタンスやクラスのフィールド。envの外側はたどらない
+func fieldLvalue(env *object.Environment, field *ast.Identifier) *lvalue {
+	return &lvalue{
+		get: func() object.Object {
+			if val, ok := env.GetLocal(field.Value); ok {
+				return val
+			}
+			return newError("undefined field: %s", field.Value)
+		},
+		set: func(val object.Object) object.Object {
+			if env.IsLocalConst(field.Value) {
+				return constError("cannot assign to constant: %s", field)
+			}
+			return env.Set(field.Value, val)
+		},
+	}
+}
+
+//a[i] = v, h[k] = v。配列とハッシュはその場で書き換える(同じ配列を指す変数からも見える)
+func assignIndex(left, index, val object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		intIndex, ok := index.(*object.Integer)
+		if !ok {
+			if index.Type() == object.INTEGER_OBJ { //BigIntegerの添字は必ず範囲外
+				return newError("index out of range: %s with length %d", index.Inspect(), len(left.Elements))
+			}
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+		idx := intIndex.Value
+		if idx < 0 || idx >= int64(len(left.Elements)) {
+			return newError("index out of range: %d with length %d", idx, len(left.Elements))
+		}
+		left.Elements[idx] = val
+		return val
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: val} //ないキーなら追加される
+		return val
+	case *object.Instance:
+		if result, ok := callSpecialMethod(left, "__setitem__", index, val); ok {
+			if isError(result) {
+				return result
+			}
+			return val
+		}
+		return newError("index assignment not supported: %s", left.Type())
+	default:
+		return newError("index assignment not supported: %s", left.Type())
 	}
-	return NULL
 }
 
 func evalForLoopExpression(fl *ast.ForLoop, env *object.Environment) object.Object { //fl:For Loop
 	innerScope := object.NewEnclosedEnvironment(env)
 
 	if fl.Init != nil {
-		init := Eval(fl.Init, innerScope)
+		init := evalForInit(fl.Init, innerScope)
 		if init.Type() == object.ERROR_OBJ {
 			return init
 		}
 	}
 
-	condition := Eval(fl.Cond, innerScope)
+	condition := evalForCondition(fl.Cond, innerScope)
 	if condition.Type() == object.ERROR_OBJ {
 		return condition
 	}
 
 	var result object.Object
+loop:
 	for isTruthy(condition) {
 		newSubScope := object.NewEnclosedEnvironment(innerScope)
-		result = Eval(fl.Block, newSubScope)
-		if result.Type() == object.ERROR_OBJ {
-			return result
+		body := Eval(fl.Block, newSubScope)
+		switch loopControl(body, fl.Label) {
+		case loopExit:
+			return body
+		case loopBreak:
+			break loop
+		case loopNext:
+			result = body
 		}
 
 		if fl.Update != nil {
@@ -628,7 +1520,7 @@ func evalForLoopExpression(fl *ast.ForLoop, env *object.Environment) object.Obje
 			}
 		}
 
-		condition = Eval(fl.Cond, newSubScope)
+		condition = evalForCondition(fl.Cond, newSubScope)
 		if condition.Type() == object.ERROR_OBJ {
 			return condition
 		}
@@ -639,3 +1531,176 @@ func evalForLoopExpression(fl *ast.ForLoop, env *object.Environment) object.Obje
 	}
 	return result
 }
+
+//for (i = 0; ...)の初期化式。iがまだ宣言されていなければ、ループの環境に宣言する
+func evalForInit(init ast.Expression, env *object.Environment) object.Object {
+	assign, ok := init.(*ast.AssignExpression)
+	if !ok || assign.Token.Type != token.ASSIGN {
+		return Eval(init, env)
+	}
+	ident, ok := assign.Name.(*ast.Identifier)
+	if !ok {
+		return Eval(init, env)
+	}
+	if _, ok := env.Get(ident.Value); ok { //外側の変数を使い回す場合
+		return Eval(init, env)
+	}
+
+	val := Eval(assign.Value, env)
+	if isError(val) {
+		return val
+	}
+	return env.Set(ident.Value, val)
+}
+
+//条件式が省略されている場合(for (;;))は常に真
+func evalForCondition(cond ast.Expression, env *object.Environment) object.Object {
+	if cond == nil {
+		return TRUE
+	}
+	return Eval(cond, env)
+}
+
+//ループ本体を評価した後にループがすること
+type loopAction int
+
+const (
+	loopNext     loopAction = iota //普通に終わったので次の繰り返しへ
+	loopContinue                   //continueされたので次の繰り返しへ
+	loopBreak                      //このループを抜ける
+	loopExit                       //return,error,外側のループ宛てのbreak/continue。結果をそのまま返す
+)
+
+//ループ本体の結果から、ラベルlabelのループがどうするかを決める
+func loopControl(result object.Object, label *ast.Identifier) loopAction {
+	switch result := result.(type) {
+	case *object.Break:
+		if isLoopTarget(result.Label, label) {
+			return loopBreak
+		}
+		return loopExit
+	case *object.Continue:
+		if isLoopTarget(result.Label, label) {
+			return loopContinue
+		}
+		return loopExit
+	case *object.ReturnValue, *object.Error:
+		return loopExit
+	}
+	return loopNext
+}
+
+//ラベルなしのbreak/continueは一番内側のループ宛て
+func isLoopTarget(target string, label *ast.Identifier) bool {
+	return target == "" || (label != nil && label.Value == target)
+}
+
+func labelName(label *ast.Identifier) string {
+	if label == nil {
+		return ""
+	}
+	return label.Value
+}
+
+//for (x in xs) / for (k, v in xs) の評価。
+//配列は(インデックス, 要素)、文字列は(インデックス, 1文字)、ハッシュは(キー, 値)をキーの順に、
+//範囲は(何番目か, 値)を回す。変数が1つの場合、ハッシュはキー、それ以外は要素が入る。
+//繰り返しごとに新しい環境を作るので、クロージャはその回の値を捕まえる。
+func evalForInExpression(fi *ast.ForInExpression, env *object.Environment) object.Object {
+	iterable := Eval(fi.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	var result object.Object
+	var exit object.Object //return,errorなど、ループの外にそのまま返すもの
+	body := func(key, value object.Object) bool {
+		scope := object.NewEnclosedEnvironment(env)
+		if fi.Key != nil {
+			scope.Set(fi.Key.Value, key)
+		}
+		scope.Set(fi.Value.Value, value)
+
+		evaluated := Eval(fi.Block, scope)
+		switch loopControl(evaluated, fi.Label) {
+		case loopExit:
+			exit = evaluated
+			return false
+		case loopBreak:
+			return false
+		case loopNext:
+			result = evaluated
+		}
+		return true
+	}
+
+	switch it := iterable.(type) {
+	case *object.Array:
+		for i, el := range it.Elements {
+			if !body(&object.Integer{Value: int64(i)}, el) {
+				break
+			}
+		}
+	case *object.String:
+		i := 0
+		for _, r := range it.Value {
+			if !body(&object.Integer{Value: int64(i)}, &object.String{Value: string(r)}) {
+				break
+			}
+			i++
+		}
+	case *object.Hash:
+		for _, pair := range it.SortedPairs() {
+			value := pair.Value
+			if fi.Key == nil { //変数が1つならキーを回す
+				value = pair.Key
+			}
+			if !body(pair.Key, value) {
+				break
+			}
+		}
+	case *object.Range:
+		var n int64
+		for i := it.Start; i < it.End; i++ {
+			if !body(&object.Integer{Value: n}, &object.Integer{Value: i}) {
+				break
+			}
+			n++
+		}
+	default:
+		return newError("cannot iterate over %s", iterable.Type())
+	}
+
+	if exit != nil {
+		return exit
+	}
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+//start..endの評価。両端とも整数でなければならない。BigIntegerの端は範囲外
+func evalRangeExpression(re *ast.RangeExpression, env *object.Environment) object.Object {
+	start := Eval(re.Start, env)
+	if isError(start) {
+		return start
+	}
+	end := Eval(re.End, env)
+	if isError(end) {
+		return end
+	}
+
+	if start.Type() != object.INTEGER_OBJ || end.Type() != object.INTEGER_OBJ {
+		return newError("range bounds must be INTEGER, got %s..%s", start.Type(), end.Type())
+	}
+	s, ok := start.(*object.Integer)
+	if !ok {
+		return newError("range bound out of range: %s", start.Inspect())
+	}
+	e, ok := end.(*object.Integer)
+	if !ok {
+		return newError("range bound out of range: %s", end.Inspect())
+	}
+	return &object.Range{Start: s.Value, End: e.Value}
+}
@@ -4,6 +4,7 @@ import (
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"strings"
 	"testing"
 )
 
@@ -27,6 +28,10 @@ func TestIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"// コメント\n5 /* 途中 */ + 5 // 行末", 10},
+		{"10 % 3", 1},
+		{"-10 % 3", -1},
+		{"2 + 7 % 4 * 2", 8},
 	}
 
 	for _, tt := range tests {
@@ -35,6 +40,147 @@ func TestIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1.5", 1.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2.0},
+		{"7 / 2.0", 3.5},
+		{"1e3 - 1", 999.0},
+		{"(1 + 2 + 3) / 4.0", 1.5},
+		{"float(3)", 3.0},
+		{`float("2.25")`, 2.25},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBigIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4294967296 * 4294967296", "18446744073709551616"},
+		{"100000000000000000000", "100000000000000000000"},
+		{"100000000000000000000 / 10", "10000000000000000000"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"(-9223372036854775807 - 1) / -1", "9223372036854775808"},
+		{`
+let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };
+fact(25)`, "15511210043330985984000000"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		result, ok := evaluated.(*object.BigInteger)
+		if !ok {
+			t.Errorf("object is not BigInteger. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("object has wrong value. got=%s, want=%s", result.Inspect(), tt.expected)
+		}
+	}
+}
+
+//BigIntegerの計算結果がint64に収まる場合はIntegerに戻り、Integerと同じ数値として扱われる
+func TestBigIntegerNormalization(t *testing.T) {
+	intTests := []struct {
+		input    string
+		expected int64
+	}{
+		{"9223372036854775808 - 1", 9223372036854775807},
+		{"(9223372036854775807 + 1) / 2", 4611686018427387904},
+		{"100000000000000000000 - 100000000000000000000", 0},
+		{"-9223372036854775808", -9223372036854775808},
+		{`{9223372036854775807: 1}[9223372036854775808 - 1]`, 1},
+		{`{100000000000000000000: 2}[10000000000 * 10000000000]`, 2},
+	}
+	for _, tt := range intTests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	boolTests := []struct {
+		input    string
+		expected bool
+	}{
+		{"100000000000000000000 > 1", true},
+		{"1 < 100000000000000000000", true},
+		{"9223372036854775807 + 1 == 9223372036854775808", true},
+		{"100000000000000000000 == 1", false},
+		{"100000000000000000000 > 1.5", true},
+	}
+	for _, tt := range boolTests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g,want=%g",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func TestNumericConversions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"7 / 2", 3},
+		{"int(3.9)", 3},
+		{"int(-3.9)", -3},
+		{`int("42")`, 42},
+		{`str(1.5) + "!"`, "1.5!"},
+		{`str(2.0)`, "2.0"},
+		{`str(10)`, "10"},
+		{"1 < 1.5", true},
+		{"2.0 == 2", true},
+		{"2.5 > 3", false},
+		{`int("abc")`, "could not parse \"abc\" as integer"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("String has wrong value. expected=%q, got=%q", expected, obj.Value)
+				}
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, obj.Message)
+				}
+			default:
+				t.Errorf("object is not String or Error. got=%T (%+v)", evaluated, evaluated)
+			}
+		}
+	}
+}
+
 //inputを渡すと、Eval実行まで一気にやってくれる。戻り値はObject
 func testEval(input string) object.Object {
 	l := lexer.New(input)
@@ -87,6 +233,18 @@ func TestBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"1.5 >= 1", true},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
 	}
 
 	for _, tt := range tests {
@@ -110,6 +268,37 @@ func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	return true
 }
 
+//&&と||は左辺で結果が決まる場合に右辺を評価しない
+func TestLogicalShortCircuit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"false && foobar", false},
+		{"true || foobar", true},
+		{"let f = fn() { 1 + true }; false && f()", false},
+		{"true && foobar", "identifier not found: foobar"},
+		{"false || 1 + true", "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
 //前置演算子！の機能テスト
 func TestBangOperator(t *testing.T) {
 	tests := []struct {
@@ -242,6 +431,50 @@ func TestErrorHandling(t *testing.T) {
 			`{"name":"Monkey"}[fn(x){ x }];`,
 			"unusable as hash key: FUNCTION",
 		},
+		{
+			"5 / 0",
+			"division by zero",
+		},
+		{
+			"5 % 0",
+			"modulo by zero",
+		},
+		{
+			"let zero = 10 - 10; 100000000000000000000 / zero",
+			"division by zero",
+		},
+		{
+			"100000000000000000000 % 0",
+			"modulo by zero",
+		},
+		{
+			"5 / 0.0",
+			"division by zero",
+		},
+		{
+			"5.5 / 0",
+			"division by zero",
+		},
+		{
+			"5 % 0.0",
+			"modulo by zero",
+		},
+		{
+			"let x = 1.5; x /= -0.0",
+			"division by zero",
+		},
+		{
+			"let f = fn(x) { x }; f()",
+			"wrong number of arguments: want=1, got=0",
+		},
+		{
+			"let f = fn() { 1 }; f(1)",
+			"wrong number of arguments: want=0, got=1",
+		},
+		{
+			"[1, 2].map(fn(a, b) { a })",
+			"wrong number of arguments: want=2, got=1",
+		},
 	}
 
 	for _, tt := range tests {
@@ -263,6 +496,29 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+//評価中のGoのpanicはプロセスを落とさずにエラーobjectになる
+func TestPanicRecovery(t *testing.T) {
+	input := `let x = 1;
+boom();`
+
+	//引数の数などは評価器がチェックするので、panicする組み込み関数を環境に置いて起こす
+	env := object.NewEnvironment()
+	env.Set("boom", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		panic("boom")
+	}})
+	evaluated := Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if !strings.HasPrefix(errObj.Message, "internal error: ") {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+	if errObj.Pos.Line != 2 {
+		t.Errorf("wrong error position. got=%s", errObj.Pos)
+	}
+}
+
 //環境のテスト
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
@@ -363,6 +619,777 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestStringInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"plain"`, "plain"},
+		{`let x = 5; "x is ${x}"`, "x is 5"},
+		{`let xs = [1, 2]; "total: ${len(xs)}, items: ${xs}"`, "total: 2, items: [1, 2]"},
+		{`let name = "げんまる"; "hello ${name + "!"}"`, "hello げんまる!"},
+		{`"${1.5 * 2} ${true} ${"${"nested"}"}"`, "3.0 true nested"},
+		{`"cost: \${5}"`, "cost: ${5}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("String has wrong value. expected=%q, got=%q", tt.expected, str.Value)
+		}
+	}
+
+	evaluated := testEval(`"value: ${foobar}"`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "identifier not found: foobar" {
+		t.Errorf("expected identifier error. got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestWhileExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"while (false) { 1 }", nil},
+		{"let i = 0; while (i < 10) { i++ }; i", 10},
+		{"let i = 0; while (i < 300000) { i++ }; i", 300000},
+		{"let f = fn() { let i = 0; while (true) { i++; if (i == 5) { return i } } }; f()", 5},
+		{"let f = fn() { while (true) { while (true) { return 7 } } }; f()", 7},
+		{"while (true) { 1 + true }", "type mismatch: INTEGER + BOOLEAN"},
+		{"while (x) { 1 }", "identifier not found: x"},
+		{"let i = 0; while (i < 3) { i++; if (i == 2) { return i * 10 } }; 99", 20},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestForInExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"for (x in [1, 2, 3]) { x }", 3},
+		{"for (i, x in [10, 20, 30]) { i }", 2},
+		{"for (x in []) { x }", nil},
+		{`for (c in "げんまる") { c }`, "る"},
+		{`for (i, c in "abc") { i }`, 2},
+		{`for (k in {"b": 1, "a": 2, "c": 3}) { k }`, "c"},
+		{`for (k, v in {"b": 1, "a": 2, "c": 3}) { v }`, 3},
+		{`let first = fn(h) { for (k in h) { return k } }; first({"b": 1, 10: 2, 2: 3, "a": 4})`, 2},
+		{`let first = fn(h) { for (k in h) { return k } }; first({"b": 1, "a": 2})`, "a"},
+		{"for (i in 0..5) { i }", 4},
+		{"for (n, i in 3..6) { n }", 2},
+		{"for (i in 5..0) { i }", nil},
+		{"let n = 3; for (i in 0..n * 2) { i }", 5},
+		{"let find = fn(xs, target) { for (i, x in xs) { if (x == target) { return i } }; -1 }; find([5, 6, 7], 6)", 1},
+		{"let find = fn(xs, target) { for (i, x in xs) { if (x == target) { return i } }; -1 }; find([5, 6, 7], 8)", -1},
+		{"for (x in [1, 2]) { x }; x", "identifier not found: x"},
+		{"for (x in 5) { x }", "cannot iterate over INTEGER"},
+		{`for (x in [1, 2]) { x + "a" }`, "type mismatch: INTEGER + STRING"},
+		{`0.."a"`, "range bounds must be INTEGER, got INTEGER..STRING"},
+		{"for (i in 0..99999999999999999999) { }", "range bound out of range: 99999999999999999999"},
+		{"for (i in -99999999999999999999..0) { }", "range bound out of range: -99999999999999999999"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("String has wrong value. expected=%q, got=%q", expected, obj.Value)
+				}
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, obj.Message)
+				}
+			default:
+				t.Errorf("unexpected object for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestForLoopExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let f = fn() { for (i = 0; i < 10; i++) { if (i == 3) { return i } } }; f()", 3},
+		{"let f = fn() { for (;;) { return 7 } }; f()", 7},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBreakContinue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"for (x in [1, 2, 3, 4]) { if (x == 3) { break }; x }", 2},
+		{"for (x in [1, 2, 3, 4]) { if (x % 2 == 0) { continue }; x }", 3},
+		{"for (x in [1, 2]) { break }", nil},
+		{"for (i = 0; i < 5; i++) { if (i == 2) { break }; i * 10 }", 10},
+		{"for (i = 0; i < 5; i++) { if (i > 2) { continue }; i * 10 }", 20},
+		{"let i = 0; while (true) { if (i == 3) { break }; i++ }; i", 3},
+		{"let i = 0; while (true) { i = i + 1; if (i == 3) { break }; i * 10 }", 20},
+		{"let i = 0; while (i < 4) { i = i + 1; if (i % 2 == 0) { continue }; i * 10 }", 30},
+		{"while (true) { break }", nil},
+		{"let i = 0; for (;;) { i = i + 1; if (i == 3) { break }; i * 10 }", 20},
+		{"outer: for (i in 0..3) { for (j in 0..3) { if (i == 1) { break outer }; j } }", 2},
+		{"let f = fn() { outer: for (i in 0..3) { for (j in 0..3) { if (j == 1) { continue outer }; if (i == 2) { return i * 10 + j } } } }; f()", 20},
+		{"let f = fn() { for (x in [1, 2, 3]) { for (y in [1, 2, 3]) { if (y == 2) { break } }; if (x == 2) { return x } } }; f()", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestRangeObject(t *testing.T) {
+	evaluated := testEval("let n = 3; 0..n")
+	r, ok := evaluated.(*object.Range)
+	if !ok {
+		t.Fatalf("object is not Range. got=%T (%+v)", evaluated, evaluated)
+	}
+	if r.Start != 0 || r.End != 3 {
+		t.Errorf("wrong range. got=%s", r.Inspect())
+	}
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = [1, 2, 3]; a[1] = 20; a", []int64{1, 20, 3}},
+		{"let a = [1, 2, 3]; a[2] = a[0] + 10", 11},
+		{"let a = [1, 2, 3]; let b = a; a[0] = 9; b[0]", 9},
+		{`let h = {"a": 1}; h["a"] = 2; h["a"]`, 2},
+		{`let h = {"a": 1}; h["b"] = 3; h["b"] + h["a"]`, 4},
+		{`let h = {}; h[1] = 1; h[true] = 2; len([h[1], h[true]])`, 2},
+		{"let a = [[1, 2], [3, 4]]; a[1][0] = 30; a[1][0]", 30},
+		{"let a = [1]; a[1] = 2", "index out of range: 1 with length 1"},
+		{"let a = [1]; a[-1] = 2", "index out of range: -1 with length 1"},
+		{`let a = [1]; a["x"] = 2`, "array index must be INTEGER, got STRING"},
+		{`let h = {}; h[fn(x) { x }] = 1`, "unusable as hash key: FUNCTION"},
+		{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+		{"let a = [1]; a[0] = b", "identifier not found: b"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int64:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
+				continue
+			}
+			for i, el := range expected {
+				testIntegerObject(t, array.Elements[i], el)
+			}
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestFieldAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"class P { let x = 1; }; let p = new P(); p.x = 5; p.x", 5},
+		{"class P { let x = 1; }; let a = new P(); let b = new P(); a.x = 5; b.x", 1},
+		{"class P { let x = 1; }; let p = new P(); p.y = 7; p.y", 7},
+		{"let n = 1; n.x = 2", "cannot assign field x on INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestClassConstructors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"class P { let x = 0; let y = 0; function init(a, b) { x = a; y = b } }; let p = new P(1, 2); p.x + p.y", 3},
+		{"class P { let x = 0; function init(a) { x = a } }; let p = new P(1); let q = new P(2); p.x * 10 + q.x", 12},
+		{"class P { let x = 0; function init() { x = 5 } }; new P().x", 5},
+		{"class P { let x = 1; }; new P().x", 1},
+		{"let n = 10; class P { let x = 0; function init(a) { x = a } }; let f = fn() { let n = 3; new P(n) }; f().x", 3},
+		{"class C { let n = 0; function init(start) { n = start } function inc() { n++; n } }; let c = new C(5); c.inc(); c.inc()", 7},
+		{"class P { let x = 0; function init(a) { x = a; return 99 } }; new P(4).x", 4},
+		{"class P { let x = 0; function init(a, b) { x = a } }; new P(1)", "wrong number of arguments to P.init: want=2, got=1"},
+		{"class P { let x = 0; function init(a) { x = a } }; new P(1, 2)", "wrong number of arguments to P.init: want=1, got=2"},
+		{"class P { let x = 0; }; new P(1)", "wrong number of arguments to new P: want=0, got=1"},
+		{"class P { let x = 7; }; class Box { let cls = 0; function init(c) { cls = c } }; let b = new Box(P); new b.cls().x", 7},
+		{"class P { let x = 0; function init(a) { x = a } }; class Outer { static let Inner = 0; }; Outer.Inner = P; new Outer.Inner(3).x", 3},
+		{"class Box { let cls = 1; }; new new Box().cls()", "not a class: INTEGER"},
+		{"class C { function get(x) { x } }; new C().get()", "wrong number of arguments to C.get: want=1, got=0"},
+		{"class C { function get() { 1 } }; new C().get(1, 2, 3)", "wrong number of arguments to C.get: want=0, got=3"},
+		{"class A { function get(x) { x } }; class B extends A { }; let g = new B().get; g(1, 2)", "wrong number of arguments to A.get: want=1, got=2"},
+		{"class P { function init(a) { a + true } }; new P(1)", "type mismatch: INTEGER + BOOLEAN"},
+		{"class P { function init(a) { a } }; new P(foo)", "identifier not found: foo"},
+		{"let x = 1; new x()", "not a class: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testAssignmentResult(t, tt.input, tt.expected)
+	}
+}
+
+func TestClassInheritance(t *testing.T) {
+	animal := "class Animal { let name = \"\"; function init(n) { name = n } function speak() { name + \" makes a sound\" } function kind() { \"animal\" } }; "
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{animal + "class Dog extends Animal { function speak() { name + \" barks\" } }; new Dog(\"Rex\").speak()", "Rex barks"},
+		{animal + "class Dog extends Animal { }; new Dog(\"Rex\").speak()", "Rex makes a sound"},
+		{animal + "class Dog extends Animal { }; new Dog(\"Rex\").name", "Rex"},
+		{animal + "class Dog extends Animal { function speak() { super.speak() + \"!\" } }; new Dog(\"Rex\").speak()", "Rex makes a sound!"},
+		{animal + "class Dog extends Animal { let tricks = 0; function init(n, t) { super(n); tricks = t } }; let d = new Dog(\"Rex\", 3); d.name + \":\" + str(d.tricks)", "Rex:3"},
+		{animal + "class Dog extends Animal { function init() { super.init(\"Pochi\") } }; new Dog().name", "Pochi"},
+		{animal + "class Dog extends Animal { function kind() { \"dog\" } }; class Puppy extends Dog { function kind() { super.kind() + \"/\" + \"puppy\" } }; new Puppy(\"a\").kind()", "dog/puppy"},
+		{animal + "class Dog extends Animal { }; class Puppy extends Dog { function speak() { super.speak() } }; new Puppy(\"Taro\").speak()", "Taro makes a sound"},
+		{animal + "class Dog extends Animal { }; let a = new Dog(\"x\"); let b = new Dog(\"y\"); b.name = \"z\"; a.name", "x"},
+		{animal + "class Dog extends Animal { }; new Dog(\"x\") instanceof Animal", true},
+		{animal + "class Dog extends Animal { }; new Dog(\"x\") instanceof Dog", true},
+		{animal + "class Dog extends Animal { }; new Animal(\"x\") instanceof Dog", false},
+		{animal + "class Cat { }; new Cat() instanceof Animal", false},
+		{animal + "1 instanceof Animal", false},
+		{"1 instanceof 2", "right-hand side of instanceof must be a class, got INTEGER"},
+		{animal + "class Dog extends Animal { }; new Dog()", "wrong number of arguments to Animal.init: want=1, got=0"},
+		{animal + "class Dog extends Animal { function speak() { super.fly() } }; new Dog(\"x\").speak()", "undefined method fly in Animal"},
+		{animal + "new Animal(\"x\").fly()", "undefined field or method: fly"},
+		{"let x = 1; class Dog extends x { }", "cannot extend INTEGER"},
+		{"class Dog extends Nothing { }", "identifier not found: Nothing"},
+		{"super.speak()", "super used outside of a subclass method"},
+		{"let mk = fn() { let secret = 42; class A { function get() { secret } }; A }; let A = mk(); class B extends A { }; new B().get()", 42},
+		{"let mk = fn() { let secret = 42; class A { let v = secret + 1; }; A }; let A = mk(); class B extends A { }; new B().v", 43},
+		{"let mk = fn() { let n = 0; class A { function bump() { n += 1; n } }; A }; let A = mk(); class B extends A { }; let b = new B(); b.bump(); b.bump()", 2},
+		{"let secret = 1; let mk = fn() { let secret = 42; class A { function get() { secret } }; A }; let A = mk(); class B extends A { function mine() { secret } }; let b = new B(); b.get() * 10 + b.mine()", 421},
+	}
+
+	for _, tt := range tests {
+		testAssignmentResult(t, tt.input, tt.expected)
+	}
+}
+
+func TestThisBinding(t *testing.T) {
+	counter := "class C { let n = 0; function inc() { this.n += 1; this.n } function get() { this.n } function add(v) { n += v; this } }; "
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{counter + "let c = new C(); c.inc(); c.inc()", 2},
+		{counter + "let a = new C(); let b = new C(); a.inc(); a.inc(); b.inc(); a.n * 10 + b.n", 21},
+		{counter + "let c = new C(); c.add(1).add(2).n", 3},
+		{counter + "let c = new C(); let f = c.inc; f(); f(); c.n", 2},
+		{counter + "let a = new C(); let b = new C(); b.add(5); let fa = a.get; let fb = b.get; fa() * 10 + fb()", 5},
+		{counter + "let call = fn(g) { g() }; let c = new C(); call(c.inc); call(c.inc); c.get()", 2},
+		{counter + "let c = new C(); c.get", "<bound method C.get>"},
+		{"class C { function me() { this } }; let c = new C(); c.me() == c", true},
+		{"class P { let x = 0; function set(x) { this.x = x } }; let p = new P(); p.set(4); p.x", 4},
+		{"class P { let x = 1; function init(x) { this.x = this.x + x } }; new P(10).x", 11},
+		{"class C { let n = 0; function adder() { fn(v) { this.n += v } } }; let c = new C(); let add = c.adder(); add(3); add(4); c.n", 7},
+		{"class C { function twice(v) { this.double(v) * 2 } function double(v) { v * 2 } }; new C().twice(3)", 12},
+		{"class A { function name() { this.kind() } function kind() { \"A\" } }; class B extends A { function kind() { \"B\" } }; new B().name()", "B"},
+		{"class A { function self() { this } }; class B extends A { }; new B().self() instanceof B", true},
+		{"class C { let x = 0; function a() { b(); x } function b() { x = 5 } }; new C().a()", 5},
+		{"class C { function a() { b() } function b() { this } }; let c = new C(); c.a() == c", true},
+		{"class C { let x = 0; function a() { b(); x } function b() { x = 5 } }; let c = new C(); let d = new C(); c.a(); d.x", 0},
+		{"class A { function name() { kind() } function kind() { \"A\" } }; class B extends A { function kind() { \"B\" } }; new B().name()", "B"},
+		{"class C { function a(b) { b } function b() { 1 } }; new C().a(2)", 2},
+		{"class C { function a() { b } function b() { 1 } }; new C().a()", "<bound method C.b>"},
+		{"this", "this used outside of a method"},
+		{"let f = fn() { this.x }; f()", "this used outside of a method"},
+	}
+
+	for _, tt := range tests {
+		testAssignmentResult(t, tt.input, tt.expected)
+	}
+}
+
+func TestStaticMembers(t *testing.T) {
+	counter := "class Counter { static let count = 0; let id = 0; function init() { count += 1; id = count } static function create() { new Counter() } static function total() { Counter.count } }; "
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{counter + "Counter.count", 0},
+		{counter + "new Counter(); new Counter(); Counter.count", 2},
+		{counter + "Counter.create(); Counter.create().id", 2},
+		{counter + "Counter.create() instanceof Counter", true},
+		{counter + "new Counter(); Counter.total()", 1},
+		{counter + "let f = Counter.total; new Counter(); f()", 1},
+		{counter + "Counter.count = 10; new Counter().id", 11},
+		{counter + "Counter.count += 5; Counter.count", 5},
+		{counter + "let a = new Counter(); let b = new Counter(); a.id * 10 + b.id", 12},
+		{counter + "class Sub extends Counter { }; Sub.create(); Sub.count", 1},
+		{counter + "class Sub extends Counter { }; Sub.count = 7; Counter.count", 7},
+		{"class C { static const max = 3; }; C.max", 3},
+		{"class C { static const max = 3; }; C.max = 4", "cannot assign to constant: max"},
+		{"class C { }; C.nope", "undefined static member nope on C"},
+		{"class C { }; C.nope = 1", "undefined static field nope on C"},
+		{"class C { function f() { 1 } }; C.f()", "undefined static member f on C"},
+		{"class C { static let x = y; }", "identifier not found: y"},
+		{"class A { static let base = 10; function get() { base } }; class B extends A { }; new B().get()", 10},
+		{"class A { static let base = 10; let v = base + 1; }; class B extends A { }; new B().v", 11},
+		{"class A { static let count = 0; function init() { count += 1 } }; class B extends A { }; new B(); new B(); A.count", 2},
+		{"class A { static let base = 10; }; class B extends A { function get() { base } }; new B().get()", 10},
+		{"class C { static function a() { b() } static function b() { 1 } }; C.a()", 1},
+		{"class C { let x = 0; function init() { x = make() } static function make() { 7 } }; new C().x", 7},
+		{"class C { static let x = make(); static function make() { 3 } }; C.x", 3},
+		{"class C { static function make() { 1 } }; fields(C)", []string{}},
+		{"class A { static let n = 1; static function two() { 2 } }; class B extends A { static function sum() { n + two() } }; B.sum()", 3},
+		{"class A { static let n = 0; }; class B extends A { function inc() { n += 1 } }; new B().inc(); new B().inc(); A.n", 2},
+		{"class A { static let n = 1; }; class B extends A { static let n = 2; function get() { n } }; new B().get()", 2},
+		{"class A { static let n = 1; }; class B extends A { static let m = n + 1; }; B.m", 2},
+		{"let n = 5; class A { static let n = 1; }; class B extends A { function get() { n } }; new B().get()", 1},
+		{"class A { static let n = 1; }; class B extends A { }; n", "identifier not found: n"},
+	}
+
+	for _, tt := range tests {
+		testAssignmentResult(t, tt.input, tt.expected)
+	}
+}
+
+func TestTraits(t *testing.T) {
+	speaker := "trait Speaker { function speak(); function greet() { \"hi, \" + this.speak() } }; "
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{speaker + "class Dog implements Speaker { function speak() { \"woof\" } }; new Dog().speak()", "woof"},
+		{speaker + "class Dog implements Speaker { function speak() { \"woof\" } }; new Dog().greet()", "hi, woof"},
+		{speaker + "class Dog implements Speaker { function speak() { \"woof\" } function greet() { \"grr\" } }; new Dog().greet()", "grr"},
+		{speaker + "class Animal { function speak() { \"...\" } }; class Dog extends Animal implements Speaker { }; new Dog().greet()", "hi, ..."},
+		{speaker + "trait Named { function name() }; class Dog implements Speaker, Named { function speak() { \"woof\" } function name() { \"Rex\" } }; new Dog().name() + \" \" + new Dog().greet()", "Rex hi, woof"},
+		{speaker + "class Dog implements Speaker { function speak() { \"woof\" } }; implements(new Dog(), Speaker)", true},
+		{"let mk = fn(y) { trait S { function f() { y } }; S }; let T = mk(10); let y = 99; class D implements T { }; new D().f()", 10},
+		{"let mk = fn() { let n = 0; trait S { function next() { n += 1; n } }; S }; let T = mk(); class D implements T { }; let d = new D(); d.next(); new D().next()", 2},
+		{"trait S { function f() { base } }; class D implements S { static let base = 1; }; new D().f()", "identifier not found: base"},
+		{"trait S { function twice() { once() * 2 } function once() }; class D implements S { let v = 4; function once() { v } }; new D().twice()", 8},
+		{speaker + "class Dog implements Speaker { function speak() { \"woof\" } }; implements(Dog, Speaker)", true},
+		{speaker + "class Dog implements Speaker { function speak() { \"woof\" } }; class Puppy extends Dog { }; implements(new Puppy(), Speaker)", true},
+		{speaker + "class Cat { function speak() { \"meow\" } }; implements(new Cat(), Speaker)", false},
+		{speaker + "implements(1, Speaker)", false},
+		{speaker + "class Dog { }; implements(new Dog(), 1)", "second argument to `implements` must be TRAIT, got INTEGER"},
+		{speaker + "class Dog implements Speaker { }", "class Dog does not implement Speaker.speak"},
+		{speaker + "class Dog implements Speaker { function speak(loud) { \"woof\" } }", "Dog.speak must take 0 arguments to implement Speaker, got 1"},
+		{speaker + "class Dog implements Speaker { }; 1", "class Dog does not implement Speaker.speak"},
+		{"let x = 1; class Dog implements x { }", "cannot implement INTEGER"},
+		{"class Dog implements Nothing { }", "identifier not found: Nothing"},
+		{speaker + "new Speaker()", "not a class: TRAIT"},
+	}
+
+	for _, tt := range tests {
+		testAssignmentResult(t, tt.input, tt.expected)
+	}
+}
+
+func TestOperatorOverloading(t *testing.T) {
+	vec := `class Vec {
+	let x = 0; let y = 0;
+	function init(a, b) { x = a; y = b }
+	function __add__(o) { new Vec(x + o.x, y + o.y) }
+	function __sub__(o) { new Vec(x - o.x, y - o.y) }
+	function __mul__(k) { new Vec(x * k, y * k) }
+	function __div__(k) { new Vec(x / k, y / k) }
+	function __neg__() { new Vec(-x, -y) }
+	function __eq__(o) { o instanceof Vec && x == o.x && y == o.y }
+	function __str__() { "Vec(${x}, ${y})" }
+	function __len__() { 2 }
+	function __getitem__(i) { if (i == 0) { x } else { y } }
+	function __setitem__(i, v) { if (i == 0) { x = v } else { y = v } }
+}; `
+	money := `class Money {
+	let cents = 0;
+	function init(c) { cents = c }
+	function __lt__(o) { cents < o.cents }
+	function __call__(rate) { new Money(cents * rate) }
+}; `
+	num := `class Num {
+	let n = 0;
+	function init(v) { n = v }
+	function __lt__(o) { n < o }
+	function __eq__(o) { n == o }
+}; `
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{vec + "str(new Vec(1, 2) + new Vec(3, 4))", "Vec(4, 6)"},
+		{vec + "str(new Vec(5, 5) - new Vec(1, 2))", "Vec(4, 3)"},
+		{vec + "str(new Vec(1, 2) * 3)", "Vec(3, 6)"},
+		{vec + "str(new Vec(4, 8) / 2)", "Vec(2, 4)"},
+		{vec + "str(-new Vec(1, 2))", "Vec(-1, -2)"},
+		{vec + "let v = new Vec(1, 1); v += new Vec(2, 3); str(v)", "Vec(3, 4)"},
+		{vec + "new Vec(1, 2) == new Vec(1, 2)", true},
+		{vec + "new Vec(1, 2) == new Vec(2, 1)", false},
+		{vec + "new Vec(1, 2) != new Vec(2, 1)", true},
+		{vec + "new Vec(1, 2) == 1", false},
+		{vec + "new Vec(1, 2)", "Vec(1, 2)"},
+		{vec + "[new Vec(1, 2), new Vec(3, 4)]", "[Vec(1, 2), Vec(3, 4)]"},
+		{vec + "let v = new Vec(7, 8); \"v=${v}\"", "v=Vec(7, 8)"},
+		{vec + "len(new Vec(0, 0))", 2},
+		{vec + "let v = new Vec(7, 8); v[0] * 10 + v[1]", 78},
+		{vec + "let v = new Vec(7, 8); v[1] = 9; v[0] += 1; str(v)", "Vec(8, 9)"},
+		{money + "new Money(100) < new Money(200)", true},
+		{money + "new Money(100) > new Money(200)", false},
+		{money + "new Money(300) > new Money(200)", true},
+		{money + "new Money(200) <= new Money(200)", true},
+		{money + "new Money(200) >= new Money(300)", false},
+		{num + "new Num(3) < 5", true},
+		{num + "new Num(3) > 5", false},
+		{num + "new Num(7) > 5", true},
+		{num + "new Num(5) > 5", false},
+		{num + "new Num(3) <= 5", true},
+		{num + "new Num(5) <= 5", true},
+		{num + "new Num(7) <= 5", false},
+		{num + "new Num(5) >= 5", true},
+		{num + "new Num(3) >= 5", false},
+		{num + "5 > new Num(3)", true},
+		{num + "5 > new Num(5)", false},
+		{num + "5 >= new Num(7)", false},
+		{num + "5 >= new Num(5)", true},
+		{num + "5 < new Num(7)", true},
+		{num + "5 < new Num(5)", false},
+		{num + "5 <= new Num(5)", true},
+		{num + "5 <= new Num(3)", false},
+		{"class L { function __lt__(o) { false } }; let l = new L(); l <= l", true},
+		{"class L { function __lt__(o) { false } }; new L() <= 1", false},
+		{"class L { function __lt__(o) { 1 + true } }; new L() > 1", "type mismatch: INTEGER + BOOLEAN"},
+		{"class L { }; new L() > 1", "type mismatch: INSTANCE_OBJ > INTEGER"},
+		{money + "let m = new Money(100); m(3).cents", 300},
+		{money + "let apply = fn(f, x) { f(x) }; apply(new Money(5), 2).cents", 10},
+		{money + "new Money(1) + new Money(2)", "unknown operator: INSTANCE_OBJ + INSTANCE_OBJ"},
+		{money + "-new Money(1)", "unknown operator: -INSTANCE_OBJ"},
+		{money + "new Money(1)[0]", "index operator not supported: INSTANCE_OBJ"},
+		{money + "let m = new Money(1); m[0] = 1", "index assignment not supported: INSTANCE_OBJ"},
+		{money + "len(new Money(1))", "argument to `len` not supported, got=INSTANCE_OBJ"},
+		{vec + "new Vec(1, 2)(3)", "not a function: INSTANCE_OBJ"},
+		{"class C { function __add__() { 1 } }; new C() + 1", "wrong number of arguments to C.__add__: want=0, got=1"},
+		{"class C { function __len__() { \"x\" } }; len(new C())", "__len__ must return INTEGER, got STRING"},
+		{"class C { function __str__() { 1 } }; str(new C())", "__str__ must return STRING, got INTEGER"},
+		{"class C { function __str__() { 1 + true } }; str(new C())", "type mismatch: INTEGER + BOOLEAN"},
+		{"class C { function __str__() { 1 + true } }; \"c=${new C()}\"", "type mismatch: INTEGER + BOOLEAN"},
+		{"class C { function __str__() { 1 } }; \"c=${new C()}\"", "__str__ must return STRING, got INTEGER"},
+		//値の表示(Inspect)はエラーを返せないので、__str__が使えなければ既定の表示になる
+		{"class C { function __str__() { 1 + true } }; new C()", "<Instance:C>"},
+		{"class C { function __str__() { 1 } }; [new C()]", "[<Instance:C>]"},
+		{"class V { function __eq__(o) { true } }; new V() == 1", true},
+		{"class V { function __eq__(o) { true } }; 1 == new V()", true},
+		{"class V { function __eq__(o) { true } }; 1 != new V()", false},
+		{"class V { function __eq__(o) { true } }; new V() != 1", false},
+		{vec + "1 == new Vec(1, 2)", false},
+		{"class V { function __eq__(o) { o == 3 } }; [3 == new V(), 4 == new V(), 3 != new V()]", "[true, false, false]"},
+		{"class V { }; 1 == new V()", false},
+		{"class A { function __add__(o) { \"A\" } }; class B extends A { }; new B() + 1", "A"},
+	}
+
+	for _, tt := range tests {
+		testAssignmentResult(t, tt.input, tt.expected)
+	}
+}
+
+func TestTypeMethods(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"hello".len()`, 5},
+		{`"こんにちは".len()`, 5},
+		{`"abc".upper()`, "ABC"},
+		{`"ABC".lower()`, "abc"},
+		{`"  hi  ".trim()`, "hi"},
+		{`"a,b,c".split(",")`, "[a, b, c]"},
+		{`"a,b,c".split(",").len()`, 3},
+		{`"hello".slice(1, 3)`, "el"},
+		{`"hello".contains("ell")`, true},
+		{`"こんにちは".index("ち")`, 3},
+		{`"hello".index("z")`, -1},
+		{`"hello".startsWith("he") && "hello".endsWith("lo")`, true},
+		{`"a-b-c".replace("-", "+")`, "a+b+c"},
+		{`"ab".repeat(3)`, "ababab"},
+		{`"日本".chars()`, "[日, 本]"},
+		{`let s = "abc"; let up = s.upper; up()`, "ABC"},
+		{"[1, 2, 3].len()", 3},
+		{"[1, 2, 3].first() + [1, 2, 3].last()", 4},
+		{"[1, 2, 3].rest()", []int64{2, 3}},
+		{"let a = [1, 2]; let b = a.push(3); a.len() * 10 + b.len()", 23},
+		{"[1, 2, 3, 4].slice(1, 3)", []int64{2, 3}},
+		{"[1, 2, 3].contains(2)", true},
+		{`[1, "a", true].contains("b")`, false},
+		{"[5, 6, 7].index(7)", 2},
+		{"[1, 2, 3].map(fn(x) { x * 2 })", []int64{2, 4, 6}},
+		{"[1, 2, 3, 4].filter(fn(x) { x % 2 == 0 })", []int64{2, 4}},
+		{"[1, 2, 3, 4].reduce(fn(acc, x) { acc + x }, 0)", 10},
+		{"[1, 2, 3].map(fn(x) { x + 1 }).filter(fn(x) { x > 2 }).reduce(fn(a, x) { a * x }, 1)", 12},
+		{`[1, "a", 2].join("-")`, "1-a-2"},
+		{"[1, 2, 3].reverse()", []int64{3, 2, 1}},
+		{"[].map(fn(x) { x }).len()", 0},
+		{`{"b": 2, "a": 1}.keys()`, "[a, b]"},
+		{`{"b": 2, "a": 1}.values()`, []int64{1, 2}},
+		{`{"a": 1}.len()`, 1},
+		{`{"a": 1}.has("a")`, true},
+		{`{"a": 1}.has("b")`, false},
+		{`{"a": 1}.get("a")`, 1},
+		{`{"a": 1}.get("b")`, "null"},
+		{"let n = -5; n.abs()", 5},
+		{"5.abs()", 5},
+		{"(-9223372036854775807 - 1).abs()", "9223372036854775808"},
+		{"3.float() / 2", 1.5},
+		{"42.str()", "42"},
+		{`"abc".nope()`, "undefined method nope for STRING"},
+		{"[1].nope", "undefined method nope for ARRAY"},
+		{"true.len()", "undefined method len for BOOLEAN"},
+		{"let x = fn() {}; x.len()", "undefined method len for FUNCTION"},
+		{`"abc".split()`, "wrong number of arguments to STRING.split: want=1, got=0"},
+		{`"abc".split(1)`, "argument to `split` must be STRING, got INTEGER"},
+		{`"abc".repeat(-1)`, "repeat count out of range: -1"},
+		{`"abc".repeat(99999999999999999999)`, "repeat count out of range: 99999999999999999999"},
+		{`"abc".repeat("2")`, "argument to `repeat` must be INTEGER, got STRING"},
+		{"[1, 2].map(1)", "not a function: INTEGER"},
+		{"[1, 2].map(fn(x) { x + true })", "type mismatch: INTEGER + BOOLEAN"},
+		{`{"a": 1}.has([1])`, "unusable as hash key: ARRAY"},
+	}
+
+	for _, tt := range tests {
+		testAssignmentResult(t, tt.input, tt.expected)
+	}
+}
+
+func TestReflectionBuiltins(t *testing.T) {
+	classes := "class A { static let total = 0; let x = 1; function f() { 1 } static function make() { new A() } }; class B extends A { static let count = 0; let y = 2; function g() { 2 } function f() { 3 } }; "
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{classes + "fields(new A())", "[x]"},
+		{classes + "fields(new B())", "[x, y]"},
+		{classes + "let a = new A(); a.z = 3; fields(a)", "[x, z]"},
+		{classes + "methods(new A())", "[f]"},
+		{classes + "methods(new B())", "[f, g]"},
+		{classes + "fields(A)", "[total]"},
+		{classes + "fields(B)", "[count, total]"},
+		{classes + "methods(A)", "[make]"},
+		{classes + "methods(B)", "[make]"},
+		{"fields(1)", "argument to `fields` must be INSTANCE or CLASS, got INTEGER"},
+		{"methods()", "wrong number of arguments. got=0,want=1"},
+	}
+
+	for _, tt := range tests {
+		testAssignmentResult(t, tt.input, tt.expected)
+	}
+}
+
+func TestAssignmentScoping(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; let f = fn() { x = x + 1 }; f(); f(); x", 3},
+		{"let counter = fn() { let n = 0; fn() { n = n + 1; n } }; let c = counter(); c(); c(); c()", 3},
+		{"let counter = fn() { let n = 0; fn() { n = n + 1; n } }; let a = counter(); let b = counter(); a(); a(); b()", 1},
+		{"let x = 1; let f = fn() { let x = 10; x = x + 1; x }; f() + x", 12},
+		{"let sum = 0; for (x in [1, 2, 3]) { sum = sum + x }; sum", 6},
+		{"let i = 0; while (i < 5) { i = i + 1 }; i", 5},
+		{"let total = 0; for (i = 0; i < 4; i = i + 1) { total = total + i }; total", 6},
+		{"let i = 100; for (i = 0; i < 3; i = i + 1) { 0 }; i", 3},
+		{"for (i = 0; i < 3; i = i + 1) { 0 }; i", "identifier not found: i"},
+		{"class C { let n = 0; function inc() { n = n + 1; n } }; let c = new C(); c.inc(); c.inc()", 2},
+		{"y = 5", "assignment to undeclared variable: y"},
+		{"let f = fn() { z = 1 }; f()", "assignment to undeclared variable: z"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestIncrementDecrement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = 1; a++", 1},
+		{"let a = 1; a++; a", 2},
+		{"let a = 1; ++a", 2},
+		{"let a = 1; a--; a", 0},
+		{"let a = 1; --a", 0},
+		{"let a = 1; let b = a; a++; b", 1},
+		{"let f = fn() { let x = 5; x++; x }; f() + f()", 12},
+		{"let a = 9223372036854775807; a++; a", "9223372036854775808"},
+		{"let a = 1.5; a++; a", 2.5},
+		{"let a = [1, 2]; a[1]++; a[1]", 3},
+		{"let a = [1, 2]; let i = 0; a[i++]++; [a[0], i]", []int64{2, 1}},
+		{`let h = {"n": 1}; ++h["n"]`, 2},
+		{"class C { let n = 0; }; let c = new C(); c.n++; c.n++; c.n", 2},
+		{"let n = 0; let inc = fn() { n++ }; inc(); inc(); n", 2},
+		{"let b = true; b++", "unknown operator: BOOLEAN++"},
+		{`let s = "a"; --s`, "unknown operator: --STRING"},
+		{"x++", "identifier not found: x"},
+	}
+
+	for _, tt := range tests {
+		testAssignmentResult(t, tt.input, tt.expected)
+	}
+}
+
+func TestCompoundAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = 10; a += 5; a", 15},
+		{"let a = 10; a -= 5", 5},
+		{"let a = 10; a *= 3; a", 30},
+		{"let a = 10; a /= 4; a", 2},
+		{"let a = 10; a %= 4; a", 2},
+		{"let a = 10; a += 0.5; a", 10.5},
+		{`let s = "a"; s += "b"; s`, "ab"},
+		{"let a = [1, 2]; a[0] += 10; a[0]", 11},
+		{`let h = {"n": 1}; h["n"] *= 7; h["n"]`, 7},
+		{"class C { let n = 1; }; let c = new C(); c.n += 4; c.n", 5},
+		{"class C { let xs = [1, 2]; }; let c = new C(); c.xs[1] += 5; c.xs[1]", 7},
+		{"let sum = 0; for (x in 1..5) { sum += x }; sum", 10},
+		{"let calls = 0; let a = [0, 0]; let idx = fn() { calls++; 1 }; a[idx()] += 5; [a[1], calls]", []int64{5, 1}},
+		{"let a = 1; a /= 0", "division by zero"},
+		{"x += 1", "identifier not found: x"},
+		{"let a = 1; a += true", "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		testAssignmentResult(t, tt.input, tt.expected)
+	}
+}
+
+func testAssignmentResult(t *testing.T, input string, expected interface{}) {
+	evaluated := testEval(input)
+
+	switch expected := expected.(type) {
+	case int:
+		testIntegerObject(t, evaluated, int64(expected))
+	case float64:
+		testFloatObject(t, evaluated, expected)
+	case bool:
+		testBooleanObject(t, evaluated, expected)
+	case []int64:
+		array, ok := evaluated.(*object.Array)
+		if !ok {
+			t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+			return
+		}
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
+			return
+		}
+		for i, el := range expected {
+			testIntegerObject(t, array.Elements[i], el)
+		}
+	case string:
+		switch obj := evaluated.(type) {
+		case *object.Error:
+			if obj.Message != expected {
+				t.Errorf("wrong error message for %q. expected=%q, got=%q", input, expected, obj.Message)
+			}
+		default:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. expected=%q, got=%q", input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input   string
@@ -371,6 +1398,15 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		{`len("げんまる")`, 4},
+		{`len("a\tb\n")`, 4},
+		{"len(`a\\tb`)", 4},
+		{`slice("げんまる", 1, 3)`, "んま"},
+		{`slice([1, 2, 3], 1, 3)`, []int64{2, 3}},
+		{`slice("abc", 2, 5)`, "slice bounds out of range [2:5] with length 3"},
+		{`slice("abc", 0, 99999999999999999999)`, "slice bounds out of range [0:99999999999999999999] with length 3"},
+		{`slice([1, 2], -99999999999999999999, 1)`, "slice bounds out of range [-99999999999999999999:1] with length 2"},
+		{`slice([1, 2], "0", 1)`, "argument to `slice` must be INTEGER, got STRING"},
 		{`len(1)`, "argument to `len` not supported, got=INTEGER"},
 		{`len("one","two")`, "wrong number of arguments. got=2, want=1"},
 	}
@@ -381,7 +1417,27 @@ func TestBuiltinFunctions(t *testing.T) {
 		switch expected := tt.expeted.(type) {
 		case int:
 			testIntegerObject(t, evaluated, int64(expected))
+		case []int64:
+			arr, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if len(arr.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d",
+					len(expected), len(arr.Elements))
+				continue
+			}
+			for i, expectedElem := range expected {
+				testIntegerObject(t, arr.Elements[i], expectedElem)
+			}
 		case string:
+			if str, ok := evaluated.(*object.String); ok {
+				if str.Value != expected {
+					t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+				}
+				continue
+			}
 			errObj, ok := evaluated.(*object.Error)
 			if !ok {
 				t.Errorf("object is not Error. got=%T (%+v)",
@@ -543,6 +1599,26 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{1: 5}[1.0]`,
+			5,
+		},
+		{
+			`{2.0: 5}[2]`,
+			5,
+		},
+		{
+			`{1.5: 5}[1.5]`,
+			5,
+		},
+		{
+			`{1: 5}[1.5]`,
+			nil,
+		},
+		{
+			`{100000000000000000000: 5}[100000000000000000000.0]`,
+			5,
+		},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -555,3 +1631,103 @@ func TestHashIndexExpressions(t *testing.T) {
 	}
 
 }
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"5 + true;", 1, 3},
+		{"let a = 1;\nlet b = foobar;", 2, 9},
+		{"let f = fn(x) {\n  x + true\n};\nf(1);", 2, 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Pos.Line != tt.expectedLine || errObj.Pos.Column != tt.expectedColumn {
+			t.Errorf("wrong error position for %q. expected=%d:%d, got=%s",
+				tt.input, tt.expectedLine, tt.expectedColumn, errObj.Pos)
+		}
+	}
+}
+
+func TestConstBindings(t *testing.T) {
+	tests := []struct {
+		input          string
+		expected       interface{}
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"const x = 5; x * 2", 10, 0, 0},
+		{"const xs = [1, 2]; xs[0] = 10; xs[0]", 10, 0, 0},
+		{"const x = 1; let f = fn() { let x = 2; x = 3; x }; f()", 3, 0, 0},
+		{"const x = 1; let f = fn() { const x = 2; x }; f() + x", 3, 0, 0},
+		{"const x = 5;\nx = 6;", "cannot assign to constant: x", 2, 1},
+		{"const x = 5;\nlet f = fn() {\n  x += 1\n};\nf();", "cannot assign to constant: x", 3, 3},
+		{"const x = 5; x++", "cannot assign to constant: x", 1, 14},
+		{"const x = 5; --x", "cannot assign to constant: x", 1, 16},
+		{"const x = 5; let x = 6;", "cannot redeclare constant: x", 1, 18},
+		{"class C { const n = 1; }; let c = new C(); c.n = 2", "cannot assign to constant: n", 1, 46},
+		{"const n = 0; for (n = 0; n < 3; n++) { n }", "cannot assign to constant: n", 1, 19},
+		{"const xs = [1]; for (x in xs) { xs = [] }", "cannot assign to constant: xs", 1, 33},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+			if errObj.Pos.Line != tt.expectedLine || errObj.Pos.Column != tt.expectedColumn {
+				t.Errorf("wrong error position for %q. expected=%d:%d, got=%s",
+					tt.input, tt.expectedLine, tt.expectedColumn, errObj.Pos)
+			}
+		}
+	}
+}
+
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"abc"[0]`, "a"},
+		{`"げんまる"[2]`, "ま"},
+		{`let s = "こんにちは"; s[len(s) - 1]`, "は"},
+		{`"abc"[3]`, nil},
+		{`"abc"[-1]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		expected, ok := tt.expected.(string)
+		if !ok {
+			testNullObject(t, evaluated)
+			continue
+		}
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if str.Value != expected {
+			t.Errorf("String has wrong value. expected=%q, got=%q", expected, str.Value)
+		}
+	}
+}
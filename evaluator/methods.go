@@ -0,0 +1,336 @@
+package evaluator
+
+import (
+	"math"
+	"monkey/object"
+	"strings"
+	"unicode/utf8"
+)
+
+//組み込みの型のメソッド。"abc".upper() のように.で呼ぶ。receiverは.の左側の値
+type builtinMethod struct {
+	arity int //引数の数(receiverは含まない)
+	fn    func(receiver object.Object, args []object.Object) object.Object
+}
+
+//型ごとのメソッド表。
+//mapなどは関数を呼ぶ(Evalを参照する)ので、変数の初期化に書くと初期化が循環する。initで入れる
+var typeMethods map[object.ObjectType]map[string]*builtinMethod
+
+func init() {
+	typeMethods = map[object.ObjectType]map[string]*builtinMethod{
+		object.STRING_OBJ:  stringMethods,
+		object.ARRAY_OBJ:   arrayMethods,
+		object.HASH_OBJ:    hashMethods,
+		object.INTEGER_OBJ: integerMethods,
+	}
+}
+
+//receiverのnameメソッドを、receiverに結びついた組み込み関数にする
+func lookupTypeMethod(receiver object.Object, name string) object.Object {
+	method, ok := typeMethods[receiver.Type()][name]
+	if !ok {
+		return newError("undefined method %s for %s", name, receiver.Type())
+	}
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != method.arity {
+				return newError("wrong number of arguments to %s.%s: want=%d, got=%d",
+					receiver.Type(), name, method.arity, len(args))
+			}
+			return method.fn(receiver, args)
+		},
+	}
+}
+
+//同じ名前の組み込み関数をreceiverを第一引数にして呼ぶメソッド
+func builtinAsMethod(name string, arity int) *builtinMethod {
+	return &builtinMethod{
+		arity: arity,
+		fn: func(receiver object.Object, args []object.Object) object.Object {
+			return builtins[name].Fn(append([]object.Object{receiver}, args...)...)
+		},
+	}
+}
+
+//文字列を受け取るメソッド
+func stringMethod(fn func(s string) object.Object) *builtinMethod {
+	return &builtinMethod{
+		arity: 0,
+		fn: func(receiver object.Object, args []object.Object) object.Object {
+			return fn(receiver.(*object.String).Value)
+		},
+	}
+}
+
+//文字列と、文字列の引数1つを受け取るメソッド
+func stringMethod1(name string, fn func(s, arg string) object.Object) *builtinMethod {
+	return &builtinMethod{
+		arity: 1,
+		fn: func(receiver object.Object, args []object.Object) object.Object {
+			arg, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `%s` must be STRING, got %s", name, args[0].Type())
+			}
+			return fn(receiver.(*object.String).Value, arg.Value)
+		},
+	}
+}
+
+var stringMethods = map[string]*builtinMethod{
+	"len":   builtinAsMethod("len", 0),
+	"slice": builtinAsMethod("slice", 2),
+	"upper": stringMethod(func(s string) object.Object { return &object.String{Value: strings.ToUpper(s)} }),
+	"lower": stringMethod(func(s string) object.Object { return &object.String{Value: strings.ToLower(s)} }),
+	"trim":  stringMethod(func(s string) object.Object { return &object.String{Value: strings.TrimSpace(s)} }),
+	"chars": stringMethod(func(s string) object.Object { //1文字ずつの配列
+		elements := []object.Object{}
+		for _, ch := range s {
+			elements = append(elements, &object.String{Value: string(ch)})
+		}
+		return &object.Array{Elements: elements}
+	}),
+	"split": stringMethod1("split", func(s, sep string) object.Object {
+		parts := strings.Split(s, sep)
+		elements := make([]object.Object, len(parts))
+		for i, part := range parts {
+			elements[i] = &object.String{Value: part}
+		}
+		return &object.Array{Elements: elements}
+	}),
+	"contains": stringMethod1("contains", func(s, sub string) object.Object {
+		return nativeBoolToBooleanObject(strings.Contains(s, sub))
+	}),
+	"index": stringMethod1("index", func(s, sub string) object.Object { //文字単位の位置。なければ-1
+		i := strings.Index(s, sub)
+		if i < 0 {
+			return &object.Integer{Value: -1}
+		}
+		return &object.Integer{Value: int64(utf8.RuneCountInString(s[:i]))}
+	}),
+	"startsWith": stringMethod1("startsWith", func(s, prefix string) object.Object {
+		return nativeBoolToBooleanObject(strings.HasPrefix(s, prefix))
+	}),
+	"endsWith": stringMethod1("endsWith", func(s, suffix string) object.Object {
+		return nativeBoolToBooleanObject(strings.HasSuffix(s, suffix))
+	}),
+	"replace": &builtinMethod{
+		arity: 2,
+		fn: func(receiver object.Object, args []object.Object) object.Object {
+			old, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `replace` must be STRING, got %s", args[0].Type())
+			}
+			replacement, ok := args[1].(*object.String)
+			if !ok {
+				return newError("argument to `replace` must be STRING, got %s", args[1].Type())
+			}
+			return &object.String{Value: strings.ReplaceAll(receiver.(*object.String).Value, old.Value, replacement.Value)}
+		},
+	},
+	"repeat": &builtinMethod{
+		arity: 1,
+		fn: func(receiver object.Object, args []object.Object) object.Object {
+			if args[0].Type() != object.INTEGER_OBJ {
+				return newError("argument to `repeat` must be INTEGER, got %s", args[0].Type())
+			}
+			n, ok := args[0].(*object.Integer) //BigIntegerの回数は必ず範囲外
+			if !ok || n.Value < 0 || n.Value > math.MaxInt32 {
+				return newError("repeat count out of range: %s", args[0].Inspect())
+			}
+			return &object.String{Value: strings.Repeat(receiver.(*object.String).Value, int(n.Value))}
+		},
+	},
+}
+
+//配列の要素ごとにfを呼ぶ。fがエラーを返したらそこで止める
+func eachElement(arr *object.Array, f object.Object, fn func(el, result object.Object)) object.Object {
+	for _, el := range arr.Elements {
+		result := applyFunction(f, []object.Object{el})
+		if isError(result) {
+			return result
+		}
+		fn(el, result)
+	}
+	return nil
+}
+
+//配列の中でvalと==になる最初の要素の位置。なければ-1
+func arrayIndex(arr *object.Array, val object.Object) (int, object.Object) {
+	for i, el := range arr.Elements {
+		eq := evalInfixExpression("==", el, val)
+		if isError(eq) {
+			return -1, eq
+		}
+		if isTruthy(eq) {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+var arrayMethods = map[string]*builtinMethod{
+	"len":   builtinAsMethod("len", 0),
+	"first": builtinAsMethod("first", 0),
+	"last":  builtinAsMethod("last", 0),
+	"rest":  builtinAsMethod("rest", 0),
+	"push":  builtinAsMethod("push", 1),
+	"slice": builtinAsMethod("slice", 2),
+	"contains": &builtinMethod{
+		arity: 1,
+		fn: func(receiver object.Object, args []object.Object) object.Object {
+			i, err := arrayIndex(receiver.(*object.Array), args[0])
+			if err != nil {
+				return err
+			}
+			return nativeBoolToBooleanObject(i >= 0)
+		},
+	},
+	"index": &builtinMethod{
+		arity: 1,
+		fn: func(receiver object.Object, args []object.Object) object.Object {
+			i, err := arrayIndex(receiver.(*object.Array), args[0])
+			if err != nil {
+				return err
+			}
+			return &object.Integer{Value: int64(i)}
+		},
+	},
+	"map": &builtinMethod{ //[1, 2].map(f) 各要素にfを適用した新しい配列
+		arity: 1,
+		fn: func(receiver object.Object, args []object.Object) object.Object {
+			elements := []object.Object{}
+			err := eachElement(receiver.(*object.Array), args[0], func(el, result object.Object) {
+				elements = append(elements, result)
+			})
+			if err != nil {
+				return err
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"filter": &builtinMethod{ //[1, 2].filter(f) fが真を返した要素だけの新しい配列
+		arity: 1,
+		fn: func(receiver object.Object, args []object.Object) object.Object {
+			elements := []object.Object{}
+			err := eachElement(receiver.(*object.Array), args[0], func(el, result object.Object) {
+				if isTruthy(result) {
+					elements = append(elements, el)
+				}
+			})
+			if err != nil {
+				return err
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"reduce": &builtinMethod{ //[1, 2].reduce(f, initial) f(acc, el)を左から順に畳み込む
+		arity: 2,
+		fn: func(receiver object.Object, args []object.Object) object.Object {
+			acc := args[1]
+			for _, el := range receiver.(*object.Array).Elements {
+				acc = applyFunction(args[0], []object.Object{acc, el})
+				if isError(acc) {
+					return acc
+				}
+			}
+			return acc
+		},
+	},
+	"join": &builtinMethod{ //文字列の要素はそのまま、それ以外はInspectの表示でつなぐ
+		arity: 1,
+		fn: func(receiver object.Object, args []object.Object) object.Object {
+			sep, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `join` must be STRING, got %s", args[0].Type())
+			}
+			parts := []string{}
+			for _, el := range receiver.(*object.Array).Elements {
+				if str, ok := el.(*object.String); ok {
+					parts = append(parts, str.Value)
+				} else {
+					parts = append(parts, el.Inspect())
+				}
+			}
+			return &object.String{Value: strings.Join(parts, sep.Value)}
+		},
+	},
+	"reverse": &builtinMethod{ //逆順の新しい配列
+		arity: 0,
+		fn: func(receiver object.Object, args []object.Object) object.Object {
+			elements := receiver.(*object.Array).Elements
+			reversed := make([]object.Object, len(elements))
+			for i, el := range elements {
+				reversed[len(elements)-1-i] = el
+			}
+			return &object.Array{Elements: reversed}
+		},
+	},
+}
+
+var hashMethods = map[string]*builtinMethod{
+	"len": &builtinMethod{
+		arity: 0,
+		fn: func(receiver object.Object, args []object.Object) object.Object {
+			return &object.Integer{Value: int64(len(receiver.(*object.Hash).Pairs))}
+		},
+	},
+	"keys": &builtinMethod{ //for-inと同じ順に並べる
+		arity: 0,
+		fn: func(receiver object.Object, args []object.Object) object.Object {
+			keys := []object.Object{}
+			for _, pair := range receiver.(*object.Hash).SortedPairs() {
+				keys = append(keys, pair.Key)
+			}
+			return &object.Array{Elements: keys}
+		},
+	},
+	"values": &builtinMethod{
+		arity: 0,
+		fn: func(receiver object.Object, args []object.Object) object.Object {
+			values := []object.Object{}
+			for _, pair := range receiver.(*object.Hash).SortedPairs() {
+				values = append(values, pair.Value)
+			}
+			return &object.Array{Elements: values}
+		},
+	},
+	"has": &builtinMethod{
+		arity: 1,
+		fn: func(receiver object.Object, args []object.Object) object.Object {
+			key, ok := args[0].(object.Hashable)
+			if !ok {
+				return newError("unusable as hash key: %s", args[0].Type())
+			}
+			_, ok = receiver.(*object.Hash).Pairs[key.HashKey()]
+			return nativeBoolToBooleanObject(ok)
+		},
+	},
+	"get": &builtinMethod{ //h[k]と同じ。キーがなければNULL
+		arity: 1,
+		fn: func(receiver object.Object, args []object.Object) object.Object {
+			return evalHashIndexExpression(receiver, args[0])
+		},
+	},
+}
+
+var integerMethods = map[string]*builtinMethod{
+	"abs": &builtinMethod{
+		arity: 0,
+		fn: func(receiver object.Object, args []object.Object) object.Object {
+			negative := false
+			switch n := receiver.(type) {
+			case *object.Integer:
+				negative = n.Value < 0
+			case *object.BigInteger:
+				negative = n.Value.Sign() < 0
+			}
+			if negative { //-9223372036854775808はBigIntegerになる
+				return evalMinusPrefixOperatorExpression(receiver)
+			}
+			return receiver
+		},
+	},
+	"float": builtinAsMethod("float", 0),
+	"str":   builtinAsMethod("str", 0),
+}
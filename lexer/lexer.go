@@ -1,36 +1,97 @@
 package lexer
 
-import "monkey/token"
+import (
+	"fmt"
+	"monkey/token"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
 type Lexer struct {
 	input        string
-	position     int  // 入力における現在の文字位置
-	readPosition int  // これから読み込む次の文字位置
-	ch           byte //現在検査中の文字, 慣習的に数値量ではなく生データであることを示す
+	position     int    // 入力における現在の文字位置
+	readPosition int    // これから読み込む次の文字位置
+	ch           rune   //現在検査中の文字(UTF-8をデコードした1文字)
+	filename     string //エラー表示用のファイル名(REPLなどでは空)
+	line         int    //chの行番号(1始まり)
+	column       int    //chの列番号(1始まり)
+
+	//trueの場合、読み飛ばしたコメントを次のトークンのCommentsに付けて残す(フォーマッタなどのツール用)
+	KeepComments bool
+
+	errors []*Error
+
+	//文字列の${...}の中を読んでいる間、その中の{}の深さを積んでおく。
+	//深さ0で}が来たら埋め込み式が終わり、文字列の続きを読む
+	interpolations []int
+}
+
+//字句解析のエラー(閉じていない文字列など)。トークンは返しつつ、ここに記録しておく
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Message
+}
+
+//これまでに起きた字句解析エラーの一覧
+func (l *Lexer) Errors() []*Error {
+	return l.errors
+}
+
+func (l *Lexer) errorAt(pos token.Position, format string, a ...interface{}) {
+	l.errors = append(l.errors, &Error{Pos: pos, Message: fmt.Sprintf(format, a...)})
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewWithFilename("", input)
+}
+
+//ファイル名付きで字句解析器を作成する。トークンの位置情報にファイル名が入る。
+func NewWithFilename(filename, input string) *Lexer {
+	l := &Lexer{input: input, filename: filename, line: 1}
 	l.readChar()
 	return l
 }
 
 //lはレシーバー,*はポインタ. tokenを読み終わって、positionをずらすため
 func (l *Lexer) readChar() {
+	if l.ch == '\n' { //改行を読み終えたら次の行へ
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
+	size := 0
 	if l.readPosition >= len(l.input) {
 		l.ch = 0 //ASCIIで"Null"の意味。ファイルの終わり
+		size = 1
 	} else {
-		l.ch = l.input[l.readPosition] //次の文字をセット
+		l.ch, size = utf8.DecodeRuneInString(l.input[l.readPosition:]) //次の文字をセット(マルチバイト文字は一文字として読む)
 	}
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += size //文字のバイト数だけ進める
 }
 
-//現在検査中のchを見て、その文字が何であるかに応じてトークンを返す。
+//次のトークンを返す。手前の空白とコメントは読み飛ばす
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+	comments := l.skipWhitespaceAndComments() //スペースとコメントを読み飛ばす。
 
-	l.skipWhitespace() //スペースを読み飛ばす。
+	tok := l.readToken()
+	if l.KeepComments {
+		tok.Comments = comments
+	}
+	return tok
+}
+
+//現在検査中のchを見て、その文字が何であるかに応じてトークンを返す。
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
+	pos := l.pos() //トークンの先頭の位置を覚えておく
 
 	switch l.ch {
 	case '=':
@@ -48,6 +109,8 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := string(ch) + string(l.ch) //現在の文字+次の文字なので"!="
 			tok = token.Token{Type: token.INCREMENT, Literal: literal}
+		} else if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.PLUS_ASSIGN)
 		} else {
 			tok = newToken(token.PLUS, l.ch)
 		}
@@ -57,6 +120,8 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := string(ch) + string(l.ch) //現在の文字+次の文字なので"!="
 			tok = token.Token{Type: token.DECREMENT, Literal: literal}
+		} else if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.MINUS_ASSIGN)
 		} else {
 			tok = newToken(token.MINUS, l.ch)
 		}
@@ -70,13 +135,47 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.SLASH_ASSIGN)
+		} else {
+			tok = newToken(token.SLASH, l.ch)
+		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.ASTERISK_ASSIGN)
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
+	case '%':
+		if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.PERCENT_ASSIGN)
+		} else {
+			tok = newToken(token.PERCENT, l.ch)
+		}
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.LT_EQ)
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.GT_EQ)
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			tok = l.newTwoCharToken(token.AND)
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			tok = l.newTwoCharToken(token.OR)
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ',':
@@ -86,8 +185,19 @@ func (l *Lexer) NextToken() token.Token {
 	case ')':
 		tok = newToken(token.RPAREN, l.ch)
 	case '{':
+		if n := len(l.interpolations); n > 0 {
+			l.interpolations[n-1]++
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
+		if n := len(l.interpolations); n > 0 {
+			if l.interpolations[n-1] == 0 { //${...}の終わり。文字列の続きを読む
+				l.interpolations = l.interpolations[:n-1]
+				tok.Literal, tok.Type = l.readString(token.INTERP_MID, token.INTERP_TAIL)
+				break
+			}
+			l.interpolations[n-1]--
+		}
 		tok = newToken(token.RBRACE, l.ch)
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
@@ -96,11 +206,17 @@ func (l *Lexer) NextToken() token.Token {
 	case ':':
 		tok = newToken(token.COLON, l.ch)
 	case '.':
-		tok = newToken(token.DOT, l.ch)
+		if l.peekChar() == '.' {
+			tok = l.newTwoCharToken(token.DOTDOT)
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 
 	case '"': //string型の追加
+		tok.Literal, tok.Type = l.readString(token.INTERP_HEAD, token.STRING)
+	case '`': //rawな文字列。エスケープせず、改行もそのまま含める
 		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok.Literal = l.readRawString()
 
 	case 0: //ASCIIの"Null"。何もない、ファイルの終わりを表す。
 		tok.Literal = ""
@@ -109,24 +225,38 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) { //文字列だった場合
 			tok.Literal = l.readIdentifier()          //文字列のまとまりを読む
 			tok.Type = token.LookupIdent(tok.Literal) //識別子typeか予約後typeを判別して代入
-			return tok                                //readChar()を呼ぶ必要がないため
+			tok.Pos = pos
+			return tok //readChar()を呼ぶ必要がないため
 		} else if isDigit(l.ch) { //数字だった場合
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Literal, tok.Type = l.readNumber() //小数点や指数があればFLOAT
+			tok.Pos = pos
 			return tok
 		} else { //その他搭載されていないILLEGALなToken
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
 	}
 	l.readChar()
+	tok.Pos = pos
 	return tok //現在検査中のchを見て、その文字が何であるかに応じてトークンを返す。
 }
 
+//現在検査中のchの位置
+func (l *Lexer) pos() token.Position {
+	return token.Position{Filename: l.filename, Line: l.line, Column: l.column}
+}
+
 //tokenTypeとchからtokenを生成する。
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
+//現在の文字と次の文字からなるトークン(<=など)を生成する。次の文字まで読み進める
+func (l *Lexer) newTwoCharToken(tokenType token.TokenType) token.Token {
+	ch := l.ch
+	l.readChar()
+	return token.Token{Type: tokenType, Literal: string(ch) + string(l.ch)}
+}
+
 //識別子を読んで、非英字に到達するまで字句解析器の位置を進めていく。
 func (l *Lexer) readIdentifier() string {
 	position := l.position
@@ -136,9 +266,43 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-//judge that is a alphabet?
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' //_も英字として認識する。
+//judge that is a letter? (ひらがなや漢字などUnicodeの文字も含む)
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_' //_も英字として認識する。
+}
+
+//空白と、//から行末までのコメント、/* */で囲まれたコメントを読み飛ばす。
+//読み飛ばしたコメントを返す。/*が閉じられないままEOFに達した場合はエラーを記録する
+func (l *Lexer) skipWhitespaceAndComments() []token.Comment {
+	var comments []token.Comment
+	for {
+		l.skipWhitespace()
+
+		if l.ch != '/' || (l.peekChar() != '/' && l.peekChar() != '*') {
+			return comments
+		}
+
+		pos := l.pos()
+		start := l.position
+		if l.peekChar() == '/' {
+			for l.ch != '\n' && l.ch != 0 {
+				l.readChar()
+			}
+		} else {
+			l.readChar() //"/*"を読み飛ばす
+			l.readChar()
+			for !(l.ch == '*' && l.peekChar() == '/') {
+				if l.ch == 0 {
+					l.errorAt(pos, "unterminated block comment")
+					return append(comments, token.Comment{Text: l.input[start:], Pos: pos})
+				}
+				l.readChar()
+			}
+			l.readChar() //"*/"を読み飛ばす
+			l.readChar()
+		}
+		comments = append(comments, token.Comment{Text: l.input[start:l.position], Pos: pos})
+	}
 }
 
 func (l *Lexer) skipWhitespace() {
@@ -148,33 +312,151 @@ func (l *Lexer) skipWhitespace() {
 }
 
 //識別子を読んで、非数字に到達するまで字句解析器の位置を進めていく。
-func (l *Lexer) readNumber() string {
+//1.5や1e10, 2.5E-3のように小数部や指数部がある場合はFLOATとする。
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	position := l.position
+	tokenType := token.TokenType(token.INT)
+	l.readDigits()
+
+	//"."の後に数字が続く場合のみ小数とする(1.methodや範囲の..と区別するため)
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+
+	//指数部 e10, e+10, e-10
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.peekChar()
+		if isDigit(next) || (next == '+' || next == '-') && isDigit(l.peekSecondChar()) {
+			tokenType = token.FLOAT
+			l.readChar()
+			if l.ch == '+' || l.ch == '-' {
+				l.readChar()
+			}
+			l.readDigits()
+		}
+	}
+	return l.input[position:l.position], tokenType
+}
+
+func (l *Lexer) readDigits() {
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	} else {
-		return l.input[l.readPosition]
+		ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+		return ch
+	}
+}
+
+//peekCharのさらに次の文字
+func (l *Lexer) peekSecondChar() rune {
+	if l.readPosition >= len(l.input) {
+		return 0
+	}
+	_, size := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	if l.readPosition+size >= len(l.input) {
+		return 0
 	}
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition+size:])
+	return ch
 }
 
-func (l *Lexer) readString() string {
+//"..."の文字列を読む。\nなどのエスケープシーケンスは変換した値を返す
+//${が来たらそこまでをinterpType、"で終わったらendTypeのトークンとして返す
+func (l *Lexer) readString(interpType, endType token.TokenType) (string, token.TokenType) {
+	start := l.pos()
+	var out strings.Builder
+	for {
+		l.readChar()
+		switch l.ch {
+		case '"':
+			return out.String(), endType
+		case 0:
+			l.errorAt(start, "unterminated string literal")
+			return out.String(), endType
+		case '$':
+			if l.peekChar() != '{' {
+				out.WriteRune(l.ch)
+				break
+			}
+			l.readChar()
+			l.interpolations = append(l.interpolations, 0)
+			return out.String(), interpType
+		case '\\':
+			l.readEscape(&out)
+		default:
+			out.WriteRune(l.ch)
+		}
+	}
+}
+
+//\の次の文字を読んで、エスケープされた文字をoutに書き込む
+func (l *Lexer) readEscape(out *strings.Builder) {
+	pos := l.pos()
+	l.readChar()
+	switch l.ch {
+	case 'n':
+		out.WriteRune('\n')
+	case 't':
+		out.WriteRune('\t')
+	case 'r':
+		out.WriteRune('\r')
+	case '0':
+		out.WriteRune(0)
+	case '"', '\\', '$':
+		out.WriteRune(l.ch)
+	case 'u': //\u{3042}のようなUnicodeのコードポイント
+		if l.peekChar() != '{' {
+			l.errorAt(pos, "invalid unicode escape: missing {")
+			return
+		}
+		l.readChar()
+		var hex strings.Builder
+		for l.peekChar() != '}' && l.peekChar() != '"' && l.peekChar() != 0 {
+			l.readChar()
+			hex.WriteRune(l.ch)
+		}
+		if l.peekChar() != '}' {
+			l.errorAt(pos, "invalid unicode escape: missing }")
+			return
+		}
+		l.readChar()
+		code, err := strconv.ParseUint(hex.String(), 16, 32)
+		if err != nil || hex.Len() > 6 || !utf8.ValidRune(rune(code)) {
+			l.errorAt(pos, "invalid unicode escape: \\u{%s}", hex.String())
+			return
+		}
+		out.WriteRune(rune(code))
+	case 0: //閉じていない文字列はreadStringでエラーにする
+	default:
+		l.errorAt(pos, "unknown escape sequence: \\%c", l.ch)
+		out.WriteRune(l.ch)
+	}
+}
+
+//`...`の文字列を読む。中身はそのまま(複数行も可)
+func (l *Lexer) readRawString() string {
+	start := l.pos()
 	position := l.position + 1
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
+		if l.ch == '`' {
+			return l.input[position:l.position]
+		}
+		if l.ch == 0 {
+			l.errorAt(start, "unterminated raw string literal")
+			return l.input[position:]
 		}
 	}
-	return l.input[position:l.position]
 }
@@ -14,7 +14,7 @@ func TestNextToken(t *testing.T) {
 		x + y;
 	};
 	let result = add(five, ten);
-	!-/*5;
+	!-/ *5; //"/*"はブロックコメントの開始になるので空白を入れる
 	5 < 10 > 5
 
 	if (5 < 10) {
@@ -140,3 +140,427 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+//各トークンの行と列が正しいかのテスト
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+	x + 10`
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.IDENT, 2, 2},
+		{token.PLUS, 2, 4},
+		{token.INT, 2, 6},
+		{token.EOF, 2, 8},
+	}
+
+	l := NewWithFilename("test.gm", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Pos.Line, tok.Pos.Column)
+		}
+		if tok.Pos.Filename != "test.gm" {
+			t.Fatalf("tests[%d] - filename wrong. got=%q", i, tok.Pos.Filename)
+		}
+	}
+}
+
+//マルチバイト文字の識別子と文字列のテスト
+func TestUnicodeTokens(t *testing.T) {
+	input := `let げんまる = "こんにちは世界";
+	げんまる + 名前 ★`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "げんまる", 5},
+		{token.ASSIGN, "=", 10},
+		{token.STRING, "こんにちは世界", 12},
+		{token.SEMICOLON, ";", 21},
+		{token.IDENT, "げんまる", 2},
+		{token.PLUS, "+", 7},
+		{token.IDENT, "名前", 9},
+		{token.ILLEGAL, "★", 12},
+		{token.EOF, "", 13},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d",
+				i, tt.expectedColumn, tok.Pos.Column)
+		}
+	}
+}
+
+func TestNumberTokens(t *testing.T) {
+	input := `5 1.5 0.25 1e10 2.5E-3 3e+2 1.foo 7e x`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "1.5"},
+		{token.FLOAT, "0.25"},
+		{token.FLOAT, "1e10"},
+		{token.FLOAT, "2.5E-3"},
+		{token.FLOAT, "3e+2"},
+		{token.INT, "1"},
+		{token.DOT, "."},
+		{token.IDENT, "foo"},
+		{token.INT, "7"},
+		{token.IDENT, "e"},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestComparisonAndLogicalTokens(t *testing.T) {
+	input := `a <= b >= c % d && e || f & |`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "d"},
+		{token.AND, "&&"},
+		{token.IDENT, "e"},
+		{token.OR, "||"},
+		{token.IDENT, "f"},
+		{token.ILLEGAL, "&"},
+		{token.ILLEGAL, "|"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestForInTokens(t *testing.T) {
+	input := `for (k, v in 0..10) { obj.x }`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FOR, "for"},
+		{token.LPAREN, "("},
+		{token.IDENT, "k"},
+		{token.COMMA, ","},
+		{token.IDENT, "v"},
+		{token.IN, "in"},
+		{token.INT, "0"},
+		{token.DOTDOT, ".."},
+		{token.INT, "10"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "obj"},
+		{token.DOT, "."},
+		{token.IDENT, "x"},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestAssignmentOperatorTokens(t *testing.T) {
+	input := `a += 1; a -= 2; a *= 3; a /= 4; a %= 5; a++; --a;`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "4"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.PERCENT_ASSIGN, "%="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.INCREMENT, "++"},
+		{token.SEMICOLON, ";"},
+		{token.DECREMENT, "--"},
+		{token.IDENT, "a"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// 最初のコメント
+let x = 10 / 2; // 行末のコメント
+/* ブロック
+   コメント */ x /* 途中 */ + 1
+// 最後のコメント`
+
+	tests := []struct {
+		expectedType     token.TokenType
+		expectedLiteral  string
+		expectedComments []string
+	}{
+		{token.LET, "let", []string{"// 最初のコメント"}},
+		{token.IDENT, "x", nil},
+		{token.ASSIGN, "=", nil},
+		{token.INT, "10", nil},
+		{token.SLASH, "/", nil},
+		{token.INT, "2", nil},
+		{token.SEMICOLON, ";", nil},
+		{token.IDENT, "x", []string{"// 行末のコメント", "/* ブロック\n   コメント */"}},
+		{token.PLUS, "+", []string{"/* 途中 */"}},
+		{token.INT, "1", nil},
+		{token.EOF, "", []string{"// 最後のコメント"}},
+	}
+
+	for _, keep := range []bool{false, true} {
+		l := New(input)
+		l.KeepComments = keep
+
+		for i, tt := range tests {
+			tok := l.NextToken()
+			if tok.Type != tt.expectedType {
+				t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+					i, tt.expectedType, tok.Type)
+			}
+			if tok.Literal != tt.expectedLiteral {
+				t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+					i, tt.expectedLiteral, tok.Literal)
+			}
+
+			expectedComments := tt.expectedComments
+			if !keep {
+				expectedComments = nil
+			}
+			if len(tok.Comments) != len(expectedComments) {
+				t.Fatalf("tests[%d] - wrong number of comments. expected=%d, got=%d",
+					i, len(expectedComments), len(tok.Comments))
+			}
+			for j, c := range tok.Comments {
+				if c.Text != expectedComments[j] {
+					t.Fatalf("tests[%d] - comment wrong. expected=%q, got=%q",
+						i, expectedComments[j], c.Text)
+				}
+			}
+		}
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	input := `x /* 閉じていない`
+
+	l := New(input)
+	l.NextToken()
+
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.EOF, tok.Type)
+	}
+	errors := l.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("wrong number of errors. expected=1, got=%d", len(errors))
+	}
+	if errors[0].Error() != "1:3: unterminated block comment" {
+		t.Fatalf("wrong error. got=%q", errors[0].Error())
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	input := `"a\nb" "tab\there" "say \"hi\"" "back\\slash" "\u{3042}\u{1F600}" ` + "`raw\\n\n  \"line\"`"
+
+	tests := []string{
+		"a\nb",
+		"tab\there",
+		`say "hi"`,
+		`back\slash`,
+		"あ😀",
+		"raw\\n\n  \"line\"",
+	}
+
+	l := New(input)
+
+	for i, expected := range tests {
+		tok := l.NextToken()
+		if tok.Type != token.STRING {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, token.STRING, tok.Type)
+		}
+		if tok.Literal != expected {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, expected, tok.Literal)
+		}
+	}
+	if len(l.Errors()) != 0 {
+		t.Fatalf("unexpected errors: %v", l.Errors())
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`let s = "abc`, "1:9: unterminated string literal"},
+		{"let s = `abc\n", "1:9: unterminated raw string literal"},
+		{`"a\qb"`, "1:3: unknown escape sequence: \\q"},
+		{`"\u{110000}"`, "1:2: invalid unicode escape: \\u{110000}"},
+		{`"\u{41"`, "1:2: invalid unicode escape: missing }"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+
+		errors := l.Errors()
+		if len(errors) != 1 {
+			t.Errorf("%q: wrong number of errors. expected=1, got=%d", tt.input, len(errors))
+			continue
+		}
+		if errors[0].Error() != tt.expectedError {
+			t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expectedError, errors[0].Error())
+		}
+	}
+}
+
+func TestInterpolatedStringTokens(t *testing.T) {
+	input := `"total: ${sum(xs)} of ${ {"a": "${n}"}["a"] }!" "no \${x}" "$5"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INTERP_HEAD, "total: "},
+		{token.IDENT, "sum"},
+		{token.LPAREN, "("},
+		{token.IDENT, "xs"},
+		{token.RPAREN, ")"},
+		{token.INTERP_MID, " of "},
+		{token.LBRACE, "{"},
+		{token.STRING, "a"},
+		{token.COLON, ":"},
+		{token.INTERP_HEAD, ""},
+		{token.IDENT, "n"},
+		{token.INTERP_TAIL, ""},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "a"},
+		{token.RBRACKET, "]"},
+		{token.INTERP_TAIL, "!"},
+		{token.STRING, "no ${x}"},
+		{token.STRING, "$5"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
@@ -1,13 +1,79 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"monkey/repl"
 	"os"
 	"os/user"
 )
 
+//使い方
+//
+//	genmaru                     REPLを起動する
+//	genmaru script.gm [args...] ファイルを実行する("-"なら標準入力から読む)
+//	genmaru -e 'expr' [args...] 引数のプログラムを実行する
+//	cat script.gm | genmaru     パイプから読んだプログラムを実行する
 func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	flags := flag.NewFlagSet("genmaru", flag.ContinueOnError)
+	expr := flags.String("e", "", "execute the given program instead of a file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: genmaru [-e program | file | -] [args...]\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return repl.ExitOK
+		}
+		return repl.ExitParseError
+	}
+	rest := flags.Args()
+
+	var setE bool
+	flags.Visit(func(f *flag.Flag) { setE = setE || f.Name == "e" })
+	if setE {
+		return repl.Run("-e", *expr, rest, os.Stderr)
+	}
+
+	if len(rest) == 0 {
+		if isTerminal(os.Stdin) {
+			startRepl()
+			return repl.ExitOK
+		}
+		rest = []string{"-"} //パイプやリダイレクトの場合は標準入力を実行する
+	}
+
+	filename, scriptArgs := rest[0], rest[1:]
+	var source []byte
+	var err error
+	if filename == "-" {
+		source, err = ioutil.ReadAll(os.Stdin)
+		filename = "<stdin>"
+	} else {
+		source, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "genmaru: %s\n", err)
+		return repl.ExitError
+	}
+	return repl.Run(filename, string(source), scriptArgs, os.Stderr)
+}
+
+//標準入力が端末かどうか(パイプやファイルならfalse)
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+func startRepl() {
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
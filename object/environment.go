@@ -1,5 +1,7 @@
 package object
 
+import "sort"
+
 //拡張する対象の環境へのポインタ
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
@@ -14,8 +16,9 @@ func NewEnvironment() *Environment {
 }
 
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store  map[string]Object
+	consts map[string]bool //constで宣言された名前。書き換えられない
+	outer  *Environment
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -26,21 +29,71 @@ func (e *Environment) Get(name string) (Object, bool) {
 	return obj, ok
 }
 
+//この環境だけを見る(外側はたどらない)。インスタンスのフィールドを探す時に使う
+func (e *Environment) GetLocal(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	return obj, ok
+}
+
+//この環境と同じ束縛(storeとconst)を共有し、外側だけをouterに差し替えた環境を返す。
+//インスタンスのフィールドを、メソッドやフィールドを定義したクラスのスコープの内側から見るのに使う
+func (e *Environment) WithOuter(outer *Environment) *Environment {
+	if e.consts == nil { //後からSetConstしても両方から見えるように、先に作っておく
+		e.consts = make(map[string]bool)
+	}
+	return &Environment{store: e.store, consts: e.consts, outer: outer}
+}
+
+//この環境自身にある名前を並べて返す(外側は見ない)
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
 
-func (s *Environment) Reset(name string, val Object) (Object, bool) {
-	var ok bool
-	_, ok = s.store[name]
-	if ok {
-		s.store[name] = val
+//constの束縛を追加する。以後IsConstがtrueになり、代入できなくなる
+func (e *Environment) SetConst(name string, val Object) Object {
+	if e.consts == nil {
+		e.consts = make(map[string]bool)
+	}
+	e.consts[name] = true
+	return e.Set(name, val)
+}
+
+//nameの一番近い束縛がconstかどうか
+func (e *Environment) IsConst(name string) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			return env.consts[name]
+		}
 	}
+	return false
+}
+
+//この環境自身にconstとしてnameがあるかどうか(外側は見ない)。同じスコープでの再宣言の確認に使う
+func (e *Environment) IsLocalConst(name string) bool {
+	return e.consts[name]
+}
 
-	if !ok {
-		s.store[name] = val
-		ok = true
+//代入。nameが定義されている一番近い環境(外側へたどる)の値を書き換える。
+//どこにも定義されていない場合や、constの場合は何もせずにfalseを返す(constかどうかはIsConstで先に確認する)
+func (e *Environment) Reset(name string, val Object) (Object, bool) {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			if env.consts[name] {
+				return nil, false
+			}
+			env.store[name] = val
+			return val, true
+		}
 	}
-	return val, ok
+	return nil, false
 }
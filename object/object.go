@@ -4,7 +4,12 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"math/big"
 	"monkey/ast"
+	"monkey/token"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -12,6 +17,7 @@ type ObjectType string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
@@ -24,6 +30,12 @@ const (
 	QUOTE_OBJ        = "QUOTE"
 	CLASS_OBJ        = "CLASS"
 	INSTANCE_OBJ     = "INSTANCE_OBJ"
+	RANGE_OBJ        = "RANGE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+	SUPER_OBJ        = "SUPER"
+	BOUND_METHOD_OBJ = "BOUND_METHOD"
+	TRAIT_OBJ        = "TRAIT"
 )
 
 type Object interface {
@@ -43,6 +55,37 @@ func NewInteger(i int64) *Integer {
 	return &Integer{Value: i}
 }
 
+//int64に収まらない整数。言語上はIntegerと同じINTEGER型として扱う
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (bi *BigInteger) Type() ObjectType { return INTEGER_OBJ }
+func (bi *BigInteger) Inspect() string  { return bi.Value.String() }
+
+//*big.Intから整数objectを作る。int64に収まる場合は*Integerを返すので、
+//BigIntegerは常にint64の範囲外の値だけを持つ
+func NewBigInteger(v *big.Int) Object {
+	if v.IsInt64() {
+		return &Integer{Value: v.Int64()}
+	}
+	return &BigInteger{Value: v}
+}
+
+//浮動小数点数
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") { //2.0が2と表示されて整数と区別できなくならないように
+		s += ".0"
+	}
+	return s
+}
+
 //真偽値
 type Boolean struct {
 	Value bool
@@ -65,13 +108,35 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+//BREAK。ReturnValueと同じように、ループに届くまでブロックの評価を中断させる
+type Break struct {
+	Label string //ラベル付きのbreakならそのラベル
+}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+//CONTINUE
+type Continue struct {
+	Label string
+}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
 //ERROR
 type Error struct {
 	Message string
+	Pos     token.Position //エラーが起きた式の位置
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "ERROR: " + e.Pos.String() + ": " + e.Message
+	}
+	return "ERROR: " + e.Message
+}
 
 type Function struct {
 	Parameters []*ast.Identifier
@@ -168,6 +233,26 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+//BigIntegerはint64の範囲外の値しか持たないので、Integerとキーが衝突しないよう別のTypeにしておく
+func (bi *BigInteger) HashKey() HashKey {
+	h := fnv.New64a()
+	if bi.Value.Sign() < 0 {
+		h.Write([]byte{'-'})
+	}
+	h.Write(bi.Value.Bytes())
+
+	return HashKey{Type: "BIG_INTEGER", Value: h.Sum64()}
+}
+
+//1.0のように整数と==になる値は、その整数と同じキーにする
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) && !math.IsInf(f.Value, 0) {
+		i, _ := big.NewFloat(f.Value).Int(nil)
+		return NewBigInteger(i).(Hashable).HashKey()
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -192,6 +277,74 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+//キーの順に並べたペアを返す。mapの順番は毎回変わるので、for-inなど順番が必要な時に使う
+//真偽値、数値、文字列の順で、同じ種類の中では値の小さい順になる
+func (h *Hash) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return keyLess(pairs[i].Key, pairs[j].Key)
+	})
+	return pairs
+}
+
+func keyLess(a, b Object) bool {
+	ra, rb := keyRank(a), keyRank(b)
+	if ra != rb {
+		return ra < rb
+	}
+	switch a := a.(type) {
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	case *String:
+		return a.Value < b.(*String).Value
+	}
+	if ra == 1 {
+		return toBigFloat(a).Cmp(toBigFloat(b)) < 0
+	}
+	return a.Inspect() < b.Inspect()
+}
+
+func keyRank(o Object) int {
+	switch o.(type) {
+	case *Boolean:
+		return 0
+	case *Integer, *BigInteger, *Float:
+		return 1
+	case *String:
+		return 2
+	default:
+		return 3
+	}
+}
+
+//数値を比較用に多倍長の浮動小数点数にする
+func toBigFloat(o Object) *big.Float {
+	switch o := o.(type) {
+	case *Integer:
+		return new(big.Float).SetInt64(o.Value)
+	case *BigInteger:
+		return new(big.Float).SetInt(o.Value)
+	case *Float:
+		if math.IsNaN(o.Value) {
+			return new(big.Float)
+		}
+		return big.NewFloat(o.Value)
+	}
+	return new(big.Float)
+}
+
+//範囲 start..end。endは含まない
+type Range struct {
+	Start int64
+	End   int64
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string  { return fmt.Sprintf("%d..%d", r.Start, r.End) }
+
 type Quote struct {
 	Node ast.Node
 }
@@ -204,9 +357,14 @@ func (q *Quote) Inspect() string {
 type Class struct {
 	Name    string
 	Parent  *Class
+	Traits  []*Trait //implementsしたトレイト
 	Members []*ast.LetStatement
 	Methods map[string]*Function
 	Env     *Environment
+
+	//staticなフィールドとメソッド。全てのインスタンスで共有する
+	Statics       *Environment
+	StaticMethods map[string]*Function
 }
 
 func (c *Class) Inspect() string {
@@ -226,10 +384,54 @@ func (c *Class) Inspect() string {
 
 func (c *Class) Type() ObjectType { return CLASS_OBJ }
 
+//トレイト。Requiredはクラスが実装しなければならないメソッド、Methodsは既定の実装
+type Trait struct {
+	Name     string
+	Required []*ast.MethodSignature
+	Methods  map[string]*Function
+}
+
+func (t *Trait) Inspect() string  { return "<trait:" + t.Name + ">" }
+func (t *Trait) Type() ObjectType { return TRAIT_OBJ }
+
 type Instance struct {
 	Class *Class
 	Env   *Environment
 }
 
-func (oi *Instance) Inspect() string  { return "<Instance:" + oi.Class.Name + ">" }
+//インスタンスを文字列にする関数。評価器が__str__メソッドを呼ぶものを入れておく。
+//__str__がなければokはfalseで、既定の表示になる
+var InspectInstance func(*Instance) (s string, ok bool)
+
+func (oi *Instance) Inspect() string {
+	if InspectInstance != nil {
+		if s, ok := InspectInstance(oi); ok {
+			return s
+		}
+	}
+	return "<Instance:" + oi.Class.Name + ">"
+}
 func (oi *Instance) Type() ObjectType { return INSTANCE_OBJ }
+
+//メソッドの中のsuper。Instanceのメソッドを、Classから親の方へたどって探す
+type Super struct {
+	Instance *Instance
+	Class    *Class //メソッドを定義したクラスの親クラス
+}
+
+func (s *Super) Inspect() string  { return "<super:" + s.Class.Name + ">" }
+func (s *Super) Type() ObjectType { return SUPER_OBJ }
+
+//インスタンスに結びついたメソッド。obj.methodを値として取り出すとこれになり、
+//後から呼んでもthisはReceiverを指す
+type BoundMethod struct {
+	Receiver *Instance
+	Owner    *Class //メソッドを定義したクラス。superはこの親を指す
+	Name     string
+	Method   *Function
+}
+
+func (bm *BoundMethod) Inspect() string {
+	return "<bound method " + bm.Owner.Name + "." + bm.Name + ">"
+}
+func (bm *BoundMethod) Type() ObjectType { return BOUND_METHOD_OBJ }
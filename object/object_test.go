@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"math/big"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -18,3 +21,105 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestBigIntegerHashKey(t *testing.T) {
+	value, _ := new(big.Int).SetString("100000000000000000000", 10)
+	big1 := NewBigInteger(value)
+	big2 := NewBigInteger(new(big.Int).Set(value))
+	small := NewBigInteger(big.NewInt(42))
+
+	if _, ok := small.(*Integer); !ok {
+		t.Fatalf("NewBigInteger with int64 value should return *Integer. got=%T", small)
+	}
+	if small.(Hashable).HashKey() != (&Integer{Value: 42}).HashKey() {
+		t.Errorf("normalized big integer has different hash key from integer")
+	}
+	if big1.(Hashable).HashKey() != big2.(Hashable).HashKey() {
+		t.Errorf("big integers with same value have different hash keys")
+	}
+	if big1.(Hashable).HashKey() == small.(Hashable).HashKey() {
+		t.Errorf("big integers with different value have same hash keys")
+	}
+}
+
+func TestFloatHashKey(t *testing.T) {
+	value, _ := new(big.Int).SetString("100000000000000000000", 10)
+
+	if (&Float{Value: 1}).HashKey() != (&Integer{Value: 1}).HashKey() {
+		t.Errorf("whole float has different hash key from integer")
+	}
+	if (&Float{Value: -0.0}).HashKey() != (&Integer{Value: 0}).HashKey() {
+		t.Errorf("negative zero has different hash key from integer 0")
+	}
+	if (&Float{Value: 1e20}).HashKey() != NewBigInteger(value).(Hashable).HashKey() {
+		t.Errorf("whole float has different hash key from big integer")
+	}
+	if (&Float{Value: 1.5}).HashKey() != (&Float{Value: 1.5}).HashKey() {
+		t.Errorf("floats with same value have different hash keys")
+	}
+	if (&Float{Value: 1.5}).HashKey() == (&Integer{Value: 1}).HashKey() {
+		t.Errorf("fractional float has same hash key as integer")
+	}
+}
+
+func TestEnvironmentReset(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("x", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(NewEnclosedEnvironment(outer))
+
+	if _, ok := inner.Reset("x", &Integer{Value: 2}); !ok {
+		t.Fatalf("Reset could not find x in outer environment")
+	}
+	x, _ := outer.Get("x")
+	if x.(*Integer).Value != 2 {
+		t.Errorf("outer x was not updated. got=%s", x.Inspect())
+	}
+	if _, ok := inner.store["x"]; ok {
+		t.Errorf("Reset created a new binding in the inner environment")
+	}
+
+	if _, ok := inner.Reset("y", &Integer{Value: 3}); ok {
+		t.Errorf("Reset of undeclared y succeeded")
+	}
+	if _, ok := inner.Get("y"); ok {
+		t.Errorf("Reset of undeclared y created a binding")
+	}
+}
+
+func TestEnvironmentConst(t *testing.T) {
+	outer := NewEnvironment()
+	outer.SetConst("c", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(outer)
+
+	if !inner.IsConst("c") {
+		t.Errorf("c is not const from inner environment")
+	}
+	if inner.IsLocalConst("c") {
+		t.Errorf("c is local const in inner environment")
+	}
+	if _, ok := inner.Reset("c", &Integer{Value: 2}); ok {
+		t.Errorf("Reset of const c succeeded")
+	}
+
+	inner.Set("c", &Integer{Value: 3}) //内側でのシャドーイングはできる
+	if inner.IsConst("c") {
+		t.Errorf("shadowed c is const")
+	}
+	c, _ := outer.Get("c")
+	if c.(*Integer).Value != 1 {
+		t.Errorf("outer c was changed. got=%s", c.Inspect())
+	}
+}
+
+func TestEnvironmentNames(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("z", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("b", &Integer{Value: 2})
+	inner.SetConst("a", &Integer{Value: 3})
+
+	names := inner.Names() //外側のzは含まない
+	if len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Errorf("wrong names. want=[a b], got=%v", names)
+	}
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"math/big"
 	"monkey/ast"
 	"monkey/lexer"
 	"monkey/token"
@@ -10,7 +11,14 @@ import (
 
 type Parser struct {
 	l              *lexer.Lexer //字句解析インスタンスへのポインタ
-	errors         []string
+	errors         []*Diagnostic
+	comments       []token.Comment                   //読んだトークンに付いていたコメント
+	lexerErrors    int                               //取り込み済みの字句解析エラーの数
+	panicMode      bool                              //エラー後、次の文の区切りまで回復していない間はtrue
+	blockDepth     int                               //解析中のブロック{}の深さ
+	loopLabels     []string                          //囲んでいるループのラベル(ラベルなしは"")。break/continueの確認に使う
+	pendingLabel   *ast.Identifier                   //直前に読んだ label: 。次のループに付ける
+	inClassBody    bool                              //クラス本体の直下を読んでいる間true。staticの確認に使う
 	curToken       token.Token                       //現在のToken
 	peekToken      token.Token                       //次のToken
 	prefixParseFns map[token.TokenType]prefixParseFn //前置のtoken.Typeから対応する関数を呼び出す
@@ -21,8 +29,11 @@ const (
 	_int = iota
 	LOWEST
 	ASSIGN
+	LOGICAL_OR  //||
+	LOGICAL_AND //&&
 	EQUELS      //==
-	LESSGREATER //> OR <
+	LESSGREATER //> OR < OR <= OR >=
+	RANGE       //0..n
 	SUM         //+
 	PRODUCT     //*
 	PREFIX      //-X OR !X
@@ -32,31 +43,44 @@ const (
 )
 
 var precedences = map[token.TokenType]int{
-	token.ASSIGN:    ASSIGN,
-	token.EQ:        EQUELS,
-	token.NOT_EQ:    EQUELS,
-	token.LT:        LESSGREATER,
-	token.GT:        LESSGREATER,
-	token.PLUS:      SUM,
-	token.MINUS:     SUM,
-	token.SLASH:     PRODUCT,
-	token.ASTERISK:  PRODUCT,
-	token.LPAREN:    CALL,
-	token.DOT:       CALL,
-	token.LBRACKET:  INDEX,
-	token.INCREMENT: INCREMENT,
-	token.DECREMENT: INCREMENT,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.PERCENT_ASSIGN:  ASSIGN,
+	token.EQ:              EQUELS,
+	token.NOT_EQ:          EQUELS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.INSTANCEOF:      LESSGREATER,
+	token.AND:             LOGICAL_AND,
+	token.OR:              LOGICAL_OR,
+	token.PERCENT:         PRODUCT,
+	token.DOTDOT:          RANGE,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.LPAREN:          CALL,
+	token.DOT:             CALL,
+	token.LBRACKET:        INDEX,
+	token.INCREMENT:       INCREMENT,
+	token.DECREMENT:       INCREMENT,
 }
 
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []*Diagnostic{},
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn) //mapの初期化(makeは指定された型の、初期化された使用できるようにしたマップを返す)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)           //識別子型の構文解析関数の登録
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)         //整数リテラル型の構文解析関数の登録
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)         //浮動小数点数リテラル型の構文解析関数の登録
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)      //前置!の構文解析関数の登録
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)     //前置-の構文解析関数の登録
 	p.registerPrefix(token.TRUE, p.parseBoolean)
@@ -65,10 +89,13 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.INTERP_HEAD, p.parseInterpolatedString)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 	p.registerPrefix(token.WHILE, p.parseWhileExpression)
 	p.registerPrefix(token.NEW, p.parseNewExpression)
+	p.registerPrefix(token.SUPER, p.parseSuperExpression)
+	p.registerPrefix(token.THIS, p.parseThisExpression)
 	p.registerPrefix(token.FOR, p.parseForLoopExpression)
 	p.registerPrefix(token.INCREMENT, p.parsePrefixExpression)
 	p.registerPrefix(token.DECREMENT, p.parsePrefixExpression)
@@ -82,12 +109,24 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.INSTANCEOF, p.parseInfixExpression)
+	p.registerInfix(token.DOTDOT, p.parseRangeExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression) //添字演算式の構文解析関数
 	p.registerInfix(token.DOT, p.parseMethodCallExpression)
 	p.registerInfix(token.INCREMENT, p.parsePostfixExpression)
 	p.registerInfix(token.DECREMENT, p.parsePostfixExpression)
 	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PERCENT_ASSIGN, p.parseAssignExpression)
 
 	//２つのトークンを読み込む
 	p.nextToken()
@@ -104,19 +143,48 @@ func (p *Parser) parseIdentifier() ast.Expression {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	p.comments = append(p.comments, p.peekToken.Comments...)
+
+	//字句解析器のエラー(閉じていない文字列など)も構文解析エラーとして扱う
+	lexerErrors := p.l.Errors()
+	for _, e := range lexerErrors[p.lexerErrors:] {
+		//字句解析エラーはトークン列の同期とは関係ないので、panic-modeに関係なく記録する
+		p.errors = append(p.errors, &Diagnostic{Pos: e.Pos, Severity: SeverityError, Message: e.Message})
+	}
+	p.lexerErrors = len(lexerErrors)
 }
 
 //Parserを受け取って、astを返却する。 メインの処理文
-func (p *Parser) ParseProgram() *ast.Program {
-	program := &ast.Program{} //最初にastルートノードの作成。
+//エラーがあっても途中で止まらず、正しく読めた文だけを持つProgramを返す。エラーはDiagnostics()で取得する。
+func (p *Parser) ParseProgram() (program *ast.Program) {
+	program = &ast.Program{} //最初にastルートノードの作成。
 	program.Statements = []ast.Statement{}
 
+	defer func() {
+		//どんな入力でも落ちないように、構文解析中のpanicは診断情報に変換する
+		if r := recover(); r != nil {
+			p.errors = append(p.errors, &Diagnostic{
+				Pos:      p.curToken.Pos,
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("internal parser error: %v", r),
+				Found:    p.curToken.Type,
+			})
+		}
+		program.Comments = p.comments
+	}()
+
 	if p.curTokenIs(token.SEMICOLON) && p.peekTokenIs(token.EOF) {
 		return program
 	}
 
 	for p.curToken.Type != token.EOF { //EOFトークンに達するまで入力のトークンを繰り返して読む。
+		start := p.curToken.Pos
 		stmt := p.parseStatement() //どんな種類の文かを判断し、そのstatementを返却する。
+		if p.panicMode {
+			//壊れた文は捨てて、次の文の始まりから読み直す
+			p.synchronize(start)
+			continue
+		}
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt) //Statementsに追加する.
 			//これはルートノードにあるスライスだった。
@@ -126,10 +194,49 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
+//文の始まりになるトークン。エラーからの回復はここで再開する
+var statementStarts = map[token.TokenType]bool{
+	token.LET:      true,
+	token.CONST:    true,
+	token.RETURN:   true,
+	token.FUNC_DEC: true,
+	token.CLASS:    true,
+	token.STATIC:   true,
+	token.TRAIT:    true,
+	token.IF:       true,
+	token.WHILE:    true,
+	token.FOR:      true,
+	token.BREAK:    true,
+	token.CONTINUE: true,
+}
+
+//エラーの後、次の文の区切りまでトークンを読み飛ばす(panic-modeからの回復)。
+//startは失敗した文の最初のトークンの位置で、そこから動いていなければ1つは進めて無限ループを防ぐ。
+//ブロックの中では}で止まり、ブロックの終わりはparseBlockStatementに任せる。
+func (p *Parser) synchronize(start token.Position) {
+	p.panicMode = false
+
+	if p.curToken.Pos == start {
+		p.nextToken()
+	}
+	for !p.curTokenIs(token.EOF) {
+		switch {
+		case p.curTokenIs(token.SEMICOLON):
+			p.nextToken()
+			return
+		case p.curTokenIs(token.RBRACE) && p.blockDepth > 0:
+			return
+		case statementStarts[p.curToken.Type]:
+			return
+		}
+		p.nextToken()
+	}
+}
+
 //どんな種類の文かを判断し、そのstatementを返却する。
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
-	case token.LET:
+	case token.LET, token.CONST:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
@@ -137,6 +244,19 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseFunctionStatement()
 	case token.CLASS:
 		return p.parseClassStatement()
+	case token.STATIC:
+		return p.parseStaticStatement()
+	case token.TRAIT:
+		return p.parseTraitStatement()
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
+	case token.IDENT:
+		if p.peekTokenIs(token.COLON) {
+			return p.parseLabeledStatement()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement() //letでもreturnでもなかったら
 	}
@@ -171,13 +291,106 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	for !p.curTokenIs(token.SEMICOLON) {
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return stmt
 
 }
 
+//break; または break label;
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+	label, ok := p.parseLoopControlLabel()
+	if !ok {
+		return nil
+	}
+	stmt.Label = label
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+//continue; または continue label;
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+	label, ok := p.parseLoopControlLabel()
+	if !ok {
+		return nil
+	}
+	stmt.Label = label
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+//break/continueの後のラベルを読み、ループの中にあるかを確認する。
+//ラベルは同じ行に書かれている場合だけ読む(次の行の式をラベルと間違えないように)
+func (p *Parser) parseLoopControlLabel() (*ast.Identifier, bool) {
+	keyword := p.curToken
+
+	var label *ast.Identifier
+	if p.peekTokenIs(token.IDENT) && p.peekToken.Pos.Line == keyword.Pos.Line {
+		p.nextToken()
+		label = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if len(p.loopLabels) == 0 {
+		p.errorAt(keyword.Pos, "%s outside loop", keyword.Literal)
+		return nil, false
+	}
+	if label != nil && !p.inLabeledLoop(label.Value) {
+		p.errorAt(label.Pos(), "unknown loop label: %s", label.Value)
+		return nil, false
+	}
+	return label, true
+}
+
+func (p *Parser) inLabeledLoop(name string) bool {
+	for _, l := range p.loopLabels {
+		if l == name {
+			return true
+		}
+	}
+	return false
+}
+
+//label: while (...) { ... } のようにラベルの付いたループ
+func (p *Parser) parseLabeledStatement() ast.Statement {
+	label := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	p.nextToken() //:
+
+	if !p.peekTokenIs(token.WHILE) && !p.peekTokenIs(token.FOR) {
+		p.errorAt(p.peekToken.Pos, "label %s must be followed by a loop, got %s", label.Value, p.peekToken.Type)
+		return nil
+	}
+	p.nextToken()
+
+	p.pendingLabel = label
+	return p.parseExpressionStatement()
+}
+
+//ループの本体を解析する。本体の中のbreak/continueが確認できるように、ループのラベルを積んでおく
+func (p *Parser) parseLoopBody(label *ast.Identifier) *ast.BlockStatement {
+	name := ""
+	if label != nil {
+		name = label.Value
+	}
+	p.loopLabels = append(p.loopLabels, name)
+	defer func() { p.loopLabels = p.loopLabels[:len(p.loopLabels)-1] }()
+
+	return p.parseBlockStatement()
+}
+
+//直前のlabel: を取り出す。ループの解析の最初に呼ぶ
+func (p *Parser) takeLabel() *ast.Identifier {
+	label := p.pendingLabel
+	p.pendingLabel = nil
+	return label
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken} //ASTNodeの構築
 
@@ -207,14 +420,78 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 		return false
 	}
 }
+
+//診断情報の重大度。今はエラーだけ
+type Severity int
+
+const (
+	SeverityError Severity = iota
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+//構文解析の診断情報。どこで起きたのか、何を期待して何が見つかったのかを持つ
+type Diagnostic struct {
+	Pos      token.Position
+	Severity Severity
+	Message  string
+	Expected []token.TokenType //期待していたトークン(分かる場合のみ)
+	Found    token.TokenType   //実際に見つかったトークン
+}
+
+func (d *Diagnostic) Error() string {
+	return d.Pos.String() + ": " + d.Message
+}
+
+//"line:col: msg"形式のエラーメッセージ一覧を返す
 func (p *Parser) Errors() []string {
+	msgs := make([]string, 0, len(p.errors))
+	for _, d := range p.errors {
+		msgs = append(msgs, d.Error())
+	}
+	return msgs
+}
+
+//位置情報付きの診断情報一覧を返す。ソースの該当箇所を表示する時に使う
+func (p *Parser) Diagnostics() []*Diagnostic {
 	return p.errors
 }
 
+//posの位置でエラーを記録する。
+//回復するまでの間(panic-mode)に起きたエラーは、最初のエラーの巻き添えなので記録しない。
+func (p *Parser) report(d *Diagnostic) {
+	if p.panicMode {
+		return
+	}
+	p.panicMode = true
+	p.errors = append(p.errors, d)
+}
+
+func (p *Parser) errorAt(pos token.Position, format string, a ...interface{}) {
+	p.report(&Diagnostic{
+		Pos:      pos,
+		Severity: SeverityError,
+		Message:  fmt.Sprintf(format, a...),
+		Found:    p.curToken.Type,
+	})
+}
+
 //peekTokenが期待にそぐわない場合、errorsスライスにmsgを追加
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s,got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.report(&Diagnostic{
+		Pos:      p.peekToken.Pos,
+		Severity: SeverityError,
+		Message:  fmt.Sprintf("expected next token to be %s,got %s instead", t, p.peekToken.Type),
+		Expected: []token.TokenType{t},
+		Found:    p.peekToken.Type,
+	})
 }
 
 type (
@@ -240,6 +517,9 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	leftExp := prefix() //一回目は現在のトークンに結びついた前置構文解析関数を実行
 
 	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() { //次の演算子トークンの左結合力が現在の右結合力(precedenc)よりも高いかを判定する
+		if leftExp == nil || p.panicMode { //左辺の解析に失敗していたら、それ以上は組み立てない
+			return nil
+		}
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
@@ -260,8 +540,27 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		//int64に収まらない場合は多倍長整数として読む
+		bigValue, ok := new(big.Int).SetString(p.curToken.Literal, 0)
+		if !ok {
+			p.errorAt(p.curToken.Pos, "could not parse %q as integer", p.curToken.Literal)
+			return nil
+		}
+		lit.Big = bigValue
+		return lit
+	}
+	lit.Value = value
+
+	return lit
+}
+
+//浮動小数点数リテラルの構文解析関数
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		p.errorAt(p.curToken.Pos, "could not parse %q as float", p.curToken.Literal)
 		return nil
 	}
 	lit.Value = value
@@ -270,8 +569,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg) //構文解析器のerrorsに追加する。
+	p.errorAt(p.curToken.Pos, "no prefix parse function for %s found", t) //構文解析器のerrorsに追加する。
 }
 
 //rightには、expressionをparseした値を入れる。()
@@ -284,6 +582,16 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 
 	expression.Right = p.parseExpression(PREFIX) //前置の右、つまりトークンを進めたあとのものを式としてparseした値
 
+	if expression.Operator == "++" || expression.Operator == "--" { //++x は代入できるものにしか使えない
+		if expression.Right == nil || p.panicMode { //右側の解析に失敗している(エラーは報告済み)。途中までのノードは見ない
+			return nil
+		}
+		if !isAssignable(expression.Right) {
+			p.errorAt(expression.Token.Pos, "cannot apply %s to %s", expression.Operator, expression.Right.String())
+			return nil
+		}
+	}
+
 	return expression
 }
 
@@ -301,6 +609,10 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 
 func (p *Parser) parsePostfixExpression(left ast.Expression) ast.Expression {
 	expression := &ast.PostfixExpression{Token: p.curToken, Left: left, Operator: p.curToken.Literal}
+	if !isAssignable(left) {
+		p.errorAt(expression.Token.Pos, "cannot apply %s to %s", expression.Operator, left.String())
+		return nil
+	}
 	return expression
 }
 
@@ -371,24 +683,41 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
 
+	p.blockDepth++
+	defer func() { p.blockDepth-- }()
+
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		start := p.curToken.Pos
 		stmt := p.parseStatement()
+		if p.panicMode { //ブロックの中でも文の区切りで回復する
+			p.synchronize(start)
+			continue
+		}
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
 		p.nextToken()
 	}
+	if p.curTokenIs(token.EOF) {
+		p.errorAt(p.curToken.Pos, "expected } to close block, got EOF")
+	}
 	return block
 }
 
 //function genmaru(x){x+1}
 func (p *Parser) parseFunctionStatement() *ast.FunctionStatement {
 	stmt := &ast.FunctionStatement{Token: p.curToken}
-	p.nextToken()
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	stmt.FunctionLiteral = p.parseFunctionLiteral().(*ast.FunctionLiteral)
+	lit, ok := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+	if !ok {
+		return nil
+	}
+	stmt.FunctionLiteral = lit
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -402,13 +731,30 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 	lit.Parameters = p.parseFunctionParameters()
+	if lit.Parameters == nil {
+		return nil
+	}
+
+	lit.Body = p.parseFunctionBody()
+	if lit.Body == nil {
+		return nil
+	}
+	return lit
+}
 
+//関数の本体の{ ... }
+func (p *Parser) parseFunctionBody() *ast.BlockStatement {
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
-	lit.Body = p.parseBlockStatement()
 
-	return lit
+	//関数の本体から外側のループはbreakできない。メソッドの本体はクラス本体の直下ではない
+	loopLabels, inClassBody := p.loopLabels, p.inClassBody
+	p.loopLabels, p.inClassBody = nil, false
+	body := p.parseBlockStatement()
+	p.loopLabels, p.inClassBody = loopLabels, inClassBody
+
+	return body
 }
 
 //カンマで区切られたリストから識別子を繰り返し構築し、パラメータのスライスを組み立てる。
@@ -421,14 +767,18 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		return identifiers //からのスライスが返される。
 	}
 	//パラメータが存在する場合以下
-	p.nextToken()
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
 
 	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	identifiers = append(identifiers, ident)
 
 	for p.peekTokenIs(token.COMMA) {
-		p.nextToken() //この時点コンマ
-		p.nextToken() //この時点次のパラメータ(引数)
+		p.nextToken()                   //この時点コンマ
+		if !p.expectPeek(token.IDENT) { //この時点次のパラメータ(引数)
+			return nil
+		}
 		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 		identifiers = append(identifiers, ident)
 	}
@@ -478,6 +828,27 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+//"a${x}b"の構文解析。INTERP_HEAD 式 (INTERP_MID 式)* INTERP_TAIL の並びになっている
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.curToken}
+	str.Parts = append(str.Parts, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+
+	for {
+		p.nextToken()
+		str.Parts = append(str.Parts, p.parseExpression(LOWEST))
+
+		if p.peekTokenIs(token.INTERP_TAIL) {
+			p.nextToken()
+			str.Parts = append(str.Parts, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+			return str
+		}
+		if !p.expectPeek(token.INTERP_MID) {
+			return nil
+		}
+		str.Parts = append(str.Parts, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+	}
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 	array.Elements = p.parseExpressionList(token.RBRACKET)
@@ -527,7 +898,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 
 //While構文解析
 func (p *Parser) parseWhileExpression() ast.Expression {
-	expression := &ast.WhileExpression{Token: p.curToken}
+	expression := &ast.WhileExpression{Token: p.curToken, Label: p.takeLabel()}
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
@@ -542,7 +913,7 @@ func (p *Parser) parseWhileExpression() ast.Expression {
 		return nil
 	}
 
-	expression.Consequence = p.parseBlockStatement() //curTokenが{に来た時にする
+	expression.Consequence = p.parseLoopBody(expression.Label) //curTokenが{に来た時にする
 
 	return expression
 }
@@ -553,32 +924,159 @@ func (p *Parser) parseClassLiteral() ast.Expression {
 		Token:   p.curToken,
 		Members: make([]*ast.LetStatement, 0),
 		Methods: make(map[string]*ast.FunctionStatement),
-	}
-	p.nextToken()
 
-	if !p.curTokenIs(token.LBRACE) {
+		StaticMembers: make([]*ast.LetStatement, 0),
+		StaticMethods: make(map[string]*ast.FunctionStatement),
+	}
+	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
+	inClassBody := p.inClassBody
+	p.inClassBody = true
 	cls.Block = p.parseBlockStatement()
+	p.inClassBody = inClassBody
 	for _, statement := range cls.Block.Statements {
 		switch s := statement.(type) {
 		case *ast.LetStatement:
 			cls.Members = append(cls.Members, s)
 		case *ast.FunctionStatement:
 			cls.Methods[s.Name.String()] = s
+		case *ast.StaticStatement:
+			switch st := s.Statement.(type) {
+			case *ast.LetStatement:
+				cls.StaticMembers = append(cls.StaticMembers, st)
+			case *ast.FunctionStatement:
+				cls.StaticMethods[st.Name.String()] = st
+			}
 		default:
+			p.errorAt(statement.Pos(), "class body may only contain let and function statements, got %s", statement.TokenLiteral())
 			return nil
 		}
 	}
 	return cls
 }
 
+//static let x = 1; static function f() {}。クラス本体の直下でだけ使える
+func (p *Parser) parseStaticStatement() ast.Statement {
+	stmt := &ast.StaticStatement{Token: p.curToken}
+	if !p.inClassBody {
+		p.errorAt(stmt.Pos(), "static is only allowed in a class body")
+		return nil
+	}
+
+	p.nextToken()
+	switch p.curToken.Type {
+	case token.LET, token.CONST:
+		if let := p.parseLetStatement(); let != nil {
+			stmt.Statement = let
+		}
+	case token.FUNC_DEC:
+		if fn := p.parseFunctionStatement(); fn != nil {
+			stmt.Statement = fn
+		}
+	default:
+		p.errorAt(p.curToken.Pos, "static must be followed by let, const or function, got %s", p.curToken.Type)
+	}
+	if stmt.Statement == nil {
+		return nil
+	}
+	return stmt
+}
+
+//trait文。本体はfunction宣言だけで、{ }のないものは実装が必要なメソッドになる
+//trait Speaker { function speak(); function greet() { "hi, " + this.speak() } }
+func (p *Parser) parseTraitStatement() ast.Statement {
+	stmt := &ast.TraitStatement{Token: p.curToken}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) && !p.peekTokenIs(token.EOF) {
+		if !p.expectPeek(token.FUNC_DEC) {
+			return nil
+		}
+		fnToken := p.curToken
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		name := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		lit := &ast.FunctionLiteral{Token: p.curToken}
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		lit.Parameters = p.parseFunctionParameters()
+		if lit.Parameters == nil {
+			return nil
+		}
+
+		if p.peekTokenIs(token.LBRACE) { //既定の実装
+			lit.Body = p.parseFunctionBody()
+			if lit.Body == nil {
+				return nil
+			}
+			stmt.Methods = append(stmt.Methods, &ast.FunctionStatement{Token: fnToken, Name: name, FunctionLiteral: lit})
+		} else {
+			stmt.Required = append(stmt.Required, &ast.MethodSignature{Name: name, Parameters: lit.Parameters})
+		}
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
 //class文のparse
 func (p *Parser) parseClassStatement() *ast.ClassStatement { //CLASStokenから始まる
 	stmt := &ast.ClassStatement{Token: p.curToken}
-	p.nextToken()
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	stmt.ClassLiteral = p.parseClassLiteral().(*ast.ClassLiteral)
+
+	var parent ast.Expression
+	if p.peekTokenIs(token.EXTENDS) { //class Dog extends Animal { ... }
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		parent = p.parseIdentifier()
+	}
+
+	//class Dog implements Speaker, Named { ... }
+	//implementsは予約語ではない(組み込み関数のimplementsと同じ名前なので)
+	var traits []ast.Expression
+	if p.peekTokenIs(token.IDENT) && p.peekToken.Literal == "implements" {
+		p.nextToken()
+		for {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			traits = append(traits, p.parseIdentifier())
+			if !p.peekTokenIs(token.COMMA) {
+				break
+			}
+			p.nextToken()
+		}
+	}
+
+	lit, ok := p.parseClassLiteral().(*ast.ClassLiteral)
+	if !ok {
+		return nil
+	}
+	lit.Parent = parent
+	lit.Traits = traits
+	stmt.ClassLiteral = lit
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -586,30 +1084,54 @@ func (p *Parser) parseClassStatement() *ast.ClassStatement { //CLASStokenから
 	return stmt
 }
 
+func (p *Parser) parseSuperExpression() ast.Expression {
+	return &ast.SuperExpression{Token: p.curToken}
+}
+
+func (p *Parser) parseThisExpression() ast.Expression {
+	return &ast.ThisExpression{Token: p.curToken}
+}
+
 //new
 func (p *Parser) parseNewExpression() ast.Expression {
 	newExp := &ast.NewExpression{Token: p.curToken}
 
 	p.nextToken()
-	exp := p.parseExpression(LOWEST)
-
-	call, ok := exp.(*ast.CallExpression)
-	if !ok {
+	newExp.Class = p.parseExpression(CALL) //(より前で止めて、引数は自分で読む
+	if newExp.Class == nil {
 		return nil
 	}
+	for p.peekTokenIs(token.DOT) { //new a.B() クラスはフィールドやstaticなメンバーでもよい。.Bの後の(は引数
+		p.nextToken()
+		access := &ast.MethodCallExpression{Token: p.curToken, Object: newExp.Class}
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		access.Call = p.parseIdentifier()
+		newExp.Class = access
+	}
 
-	newExp.Class = call.Function
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	newExp.Arguments = p.parseExpressionList(token.RPAREN) //initに渡す引数
+	if newExp.Arguments == nil {
+		return nil
+	}
 
 	return newExp
 }
 
 func (p *Parser) parseMethodCallExpression(obj ast.Expression) ast.Expression {
 	methodCall := &ast.MethodCallExpression{Token: p.curToken, Object: obj}
-	p.nextToken()
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
 
 	name := p.parseIdentifier()
 	if !p.peekTokenIs(token.LPAREN) {
-		methodCall.Call = p.parseExpression(CALL)
+		//フィールドは識別子だけ。obj.a[0]やobj.n++の[0]や++はobj.a全体にかかる
+		methodCall.Call = name
 	} else {
 		p.nextToken()
 		methodCall.Call = p.parseCallExpression(name)
@@ -617,20 +1139,45 @@ func (p *Parser) parseMethodCallExpression(obj ast.Expression) ast.Expression {
 	return methodCall
 }
 
+//for (init; cond; update) { ... } と for (x in xs) { ... } の構文解析
 func (p *Parser) parseForLoopExpression() ast.Expression {
+	forToken := p.curToken //位置情報のためにforトークンを覚えておく
+	label := p.takeLabel()
 
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
 
-	p.nextToken()
-	init := p.parseExpression(LOWEST)
-	p.nextToken()
-	p.nextToken()
-	condition := p.parseExpression(LOWEST)
-	p.nextToken()
-	p.nextToken()
-	update := p.parseExpression(LOWEST)
+	//識別子の後にinか,が続くならfor-in
+	if p.peekTokenIs(token.IDENT) {
+		p.nextToken()
+		if p.peekTokenIs(token.IN) || p.peekTokenIs(token.COMMA) {
+			return p.parseForInExpression(forToken, label)
+		}
+	} else {
+		p.nextToken()
+	}
+
+	loop := &ast.ForLoop{Token: forToken, Label: label}
+
+	//init,cond,updateはどれも省略できる
+	if !p.curTokenIs(token.SEMICOLON) {
+		loop.Init = p.parseExpression(LOWEST)
+		if !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+	if !p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+		loop.Cond = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+	if !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		loop.Update = p.parseExpression(LOWEST)
+	}
 
 	if !p.expectPeek(token.RPAREN) {
 		return nil
@@ -638,19 +1185,73 @@ func (p *Parser) parseForLoopExpression() ast.Expression {
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
-	loop := &ast.ForLoop{Token: p.curToken, Init: init, Cond: condition, Update: update}
-	loop.Block = p.parseBlockStatement()
+	loop.Block = p.parseLoopBody(label)
+
+	return loop
+}
 
-	fmt.Println(loop)
+//for (x in xs) または for (k, v in xs)。curTokenは最初の識別子
+func (p *Parser) parseForInExpression(forToken token.Token, label *ast.Identifier) ast.Expression {
+	loop := &ast.ForInExpression{Token: forToken, Label: label}
+	loop.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		loop.Key = loop.Value
+		loop.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	loop.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	loop.Block = p.parseLoopBody(label)
 
 	return loop
 }
 
+//範囲式 start..end の構文解析
+func (p *Parser) parseRangeExpression(start ast.Expression) ast.Expression {
+	exp := &ast.RangeExpression{Token: p.curToken, Start: start}
+
+	precedence := p.curPrecedence()
+	p.nextToken()
+	exp.End = p.parseExpression(precedence)
+
+	return exp
+}
+
+//代入できる式かどうか。変数、a[i]、obj.fieldのみ
+func isAssignable(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+		return true
+	case *ast.MethodCallExpression:
+		_, ok := exp.Call.(*ast.Identifier)
+		return ok
+	default:
+		return false
+	}
+}
+
 func (p *Parser) parseAssignExpression(name ast.Expression) ast.Expression {
 	e := &ast.AssignExpression{Token: p.curToken}
-	if n, ok := name.(*ast.Identifier); ok {
-		e.Name = n
+	if !isAssignable(name) {
+		p.errorAt(p.curToken.Pos, "cannot assign to %s", name.String())
+		return nil
 	}
+	e.Name = name
 	p.nextToken()
 	e.Value = p.parseExpression(LOWEST)
 	return e
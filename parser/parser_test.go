@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
+	"monkey/token"
+	"strings"
 	"testing"
 )
 
@@ -76,11 +78,36 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	t.FailNow()
 }
 
+func TestConstStatements(t *testing.T) {
+	l := lexer.New("const x = 5; let y = x;")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	constStmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok || !constStmt.IsConst() {
+		t.Fatalf("Statements[0] is not a const statement. got=%T (%s)", program.Statements[0], program.Statements[0])
+	}
+	if constStmt.Name.Value != "x" {
+		t.Errorf("constStmt.Name.Value not 'x'. got=%s", constStmt.Name.Value)
+	}
+	if program.String() != "const x = 5;let y = x;" {
+		t.Errorf("wrong program. got=%q", program.String())
+	}
+	if letStmt := program.Statements[1].(*ast.LetStatement); letStmt.IsConst() {
+		t.Errorf("let statement is const")
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	input := `
 return 5;
 return 10;
 return 993322;
+return 42
 `
 	l := lexer.New(input)
 	p := New(l)
@@ -88,8 +115,8 @@ return 993322;
 	program := p.ParseProgram()
 	checkParserErrors(t, p)
 
-	if len(program.Statements) != 3 {
-		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	if len(program.Statements) != 4 {
+		t.Fatalf("program.Statements does not contain 4 statements. got=%d", len(program.Statements))
 	}
 
 	for _, stmt := range program.Statements {
@@ -177,6 +204,35 @@ func TestIntegerLiteralExpression(t *testing.T) {
 
 }
 
+//浮動小数点数リテラルオンリーの式構文解析
+func TestFloatLiteralExpression(t *testing.T) {
+	input := "2.5e3;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program has not enough statements. got =%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Satatements[0] is not *astExpressionStatements. got =%T", program.Statements[0])
+	}
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral. got =%T", stmt.Expression)
+	}
+	if literal.Value != 2500 {
+		t.Errorf("literal.Value not %f. got=%f", 2500.0, literal.Value)
+	}
+	if literal.TokenLiteral() != "2.5e3" {
+		t.Errorf("literal.TokenLiteral not %s. got=%s", "2.5e3", literal.TokenLiteral())
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -249,6 +305,11 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"true && false", true, "&&", false},
+		{"true || false", true, "||", false},
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 	}
@@ -389,6 +450,54 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"0..n + 1",
+			"(0..(n + 1))",
+		},
+		{
+			"a < 0..n",
+			"(a < (0..n))",
+		},
+		{
+			"obj.xs[0]",
+			"(obj.xs[0])",
+		},
+		{
+			"obj.n++",
+			"(obj.n++)",
+		},
+		{
+			"d instanceof Dog == a instanceof Animal",
+			"((d instanceof Dog) == (a instanceof Animal))",
+		},
+		{
+			"x + 1 instanceof C",
+			"((x + 1) instanceof C)",
+		},
+		{
+			"this.x * 2",
+			"(this.x * 2)",
+		},
+		{
+			"a < b && c == d || !e",
+			"(((a < b) && (c == d)) || (!e))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -906,3 +1015,658 @@ func TestWhileExpression(t *testing.T) {
 	}
 
 }
+
+func TestForInExpression(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedKey   string
+		expectedValue string
+		expectedIter  string
+	}{
+		{"for (x in xs) { x }", "", "x", "xs"},
+		{"for (k, v in hash) { v }", "k", "v", "hash"},
+		{"for (i in 0..len(xs)) { i }", "", "i", "(0..len(xs))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not cotain 1 statements. got=%d", len(program.Statements))
+		}
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.ForInExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.ForInExpression. got=%T", stmt.Expression)
+		}
+		if tt.expectedKey == "" {
+			if exp.Key != nil {
+				t.Errorf("exp.Key is not nil. got=%s", exp.Key)
+			}
+		} else if !testIdentifier(t, exp.Key, tt.expectedKey) {
+			return
+		}
+		if !testIdentifier(t, exp.Value, tt.expectedValue) {
+			return
+		}
+		if exp.Iterable.String() != tt.expectedIter {
+			t.Errorf("exp.Iterable wrong. expected=%q, got=%q", tt.expectedIter, exp.Iterable.String())
+		}
+		if len(exp.Block.Statements) != 1 {
+			t.Errorf("block is not 1 statements. got=%d", len(exp.Block.Statements))
+		}
+	}
+}
+
+func TestForLoopExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (i = 0; i < 10; i++) { i }", "for ( i = 0 ; (i < 10) ; (i++) )  { i }"},
+		{"for (; i < 10;) { i }", "for (  ; (i < 10) ;  )  { i }"},
+		{"for (;;) { i }", "for (  ;  ;  )  { i }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		loop, ok := stmt.Expression.(*ast.ForLoop)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.ForLoop. got=%T", stmt.Expression)
+		}
+		if loop.String() != tt.expected {
+			t.Errorf("wrong loop. expected=%q, got=%q", tt.expected, loop.String())
+		}
+	}
+}
+
+func TestBreakContinueStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"while (x) { break; }", "WHILEx break;"},
+		{"for (x in xs) { continue }", "for (x in xs) continue;"},
+		{"outer: for (x in xs) { for (y in ys) { break outer; } }", "outer: for (x in xs) for (y in ys) break outer;"},
+		{"outer: while (a) { while (b) { continue outer } }", "outer: WHILEa WHILEb continue outer;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program. expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestLoopControlErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "1:1: break outside loop"},
+		{"if (x) { continue }", "1:10: continue outside loop"},
+		{"while (x) { fn() { break } }", "1:20: break outside loop"},
+		{"for (x in xs) { break foo }", "1:23: unknown loop label: foo"},
+		{"inner: for (x in xs) { 1 }; for (y in ys) { continue inner }", "1:54: unknown loop label: inner"},
+		{"foo: 5", "1:6: label foo must be followed by a loop, got INT"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("expected 1 error for %q, got=%d: %q", tt.input, len(errors), errors)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestAssignExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5", "x = 5"},
+		{"a[0] = b + 1", "(a[0]) = (b + 1)"},
+		{`h["k"] = 1`, "(h[k]) = 1"},
+		{"obj.field = 2", "obj.field = 2"},
+		{"a = b = 3", "a = b = 3"},
+		{"x += 1", "x += 1"},
+		{"a[i] -= 2 * 3", "(a[i]) -= (2 * 3)"},
+		{"obj.n *= 2", "obj.n *= 2"},
+		{"x /= y %= 3", "x /= y %= 3"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if _, ok := stmt.Expression.(*ast.AssignExpression); !ok {
+			t.Fatalf("stmt.Expression is not ast.AssignExpression. got=%T", stmt.Expression)
+		}
+		if program.String() != tt.expected {
+			t.Errorf("wrong program. expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 = 2", "1:3: cannot assign to 1"},
+		{"f() = 2", "1:5: cannot assign to f()"},
+		{"obj.method() = 2", "1:14: cannot assign to obj.method()"},
+		{"1 += 2", "1:3: cannot assign to 1"},
+		{"5++", "1:2: cannot apply ++ to 5"},
+		{"--f()", "1:1: cannot apply -- to f()"},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestNewExpression(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedClass string
+		expectedArgs  []string
+		expected      string
+	}{
+		{"new P()", "P", []string{}, "new P()"},
+		{"new P(1, a + b)", "P", []string{"1", "(a + b)"}, "new P(1, (a + b))"},
+		{"new P(1).x", "P", []string{"1"}, "new P(1).x"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program. expected=%q, got=%q", tt.expected, program.String())
+		}
+
+		exp := program.Statements[0].(*ast.ExpressionStatement).Expression
+		if call, ok := exp.(*ast.MethodCallExpression); ok {
+			exp = call.Object
+		}
+		newExp, ok := exp.(*ast.NewExpression)
+		if !ok {
+			t.Fatalf("exp is not ast.NewExpression. got=%T", exp)
+		}
+		if !testIdentifier(t, newExp.Class, tt.expectedClass) {
+			return
+		}
+		if len(newExp.Arguments) != len(tt.expectedArgs) {
+			t.Fatalf("wrong number of arguments. want=%d, got=%d", len(tt.expectedArgs), len(newExp.Arguments))
+		}
+		for i, arg := range tt.expectedArgs {
+			if newExp.Arguments[i].String() != arg {
+				t.Errorf("argument %d wrong. want=%q, got=%q", i, arg, newExp.Arguments[i].String())
+			}
+		}
+	}
+}
+
+func TestNewExpressionWithMemberClass(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedClass string
+		expected      string
+	}{
+		{"new a.B()", "a.B", "new a.B()"},
+		{"new a.b.C(1, 2)", "a.b.C", "new a.b.C(1, 2)"},
+		{"new a.B().x", "a.B", "new a.B().x"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program. expected=%q, got=%q", tt.expected, program.String())
+		}
+
+		exp := program.Statements[0].(*ast.ExpressionStatement).Expression
+		if call, ok := exp.(*ast.MethodCallExpression); ok { //new a.B().x
+			if n, ok := call.Object.(*ast.NewExpression); ok {
+				exp = n
+			}
+		}
+		newExp, ok := exp.(*ast.NewExpression)
+		if !ok {
+			t.Fatalf("exp is not ast.NewExpression. got=%T", exp)
+		}
+		if _, ok := newExp.Class.(*ast.MethodCallExpression); !ok {
+			t.Fatalf("class is not ast.MethodCallExpression. got=%T", newExp.Class)
+		}
+		if newExp.Class.String() != tt.expectedClass {
+			t.Errorf("wrong class. expected=%q, got=%q", tt.expectedClass, newExp.Class.String())
+		}
+	}
+
+	l := lexer.New("new a.(1)")
+	p := New(l)
+	p.ParseProgram()
+	errors := p.Errors()
+	if len(errors) == 0 || errors[0] != "1:7: expected next token to be IDENT,got ( instead" {
+		t.Errorf("wrong errors. got=%q", errors)
+	}
+}
+
+func TestClassExtends(t *testing.T) {
+	input := `class Dog extends Animal { function speak() { super.speak() } }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ClassStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ClassStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Name.Value != "Dog" {
+		t.Errorf("class name wrong. want=%q, got=%q", "Dog", stmt.Name.Value)
+	}
+	if !testIdentifier(t, stmt.ClassLiteral.Parent, "Animal") {
+		return
+	}
+
+	method, ok := stmt.ClassLiteral.Methods["speak"]
+	if !ok {
+		t.Fatalf("method speak not found")
+	}
+	body := method.FunctionLiteral.Body.Statements[0].(*ast.ExpressionStatement).Expression
+	call, ok := body.(*ast.MethodCallExpression)
+	if !ok {
+		t.Fatalf("body is not ast.MethodCallExpression. got=%T", body)
+	}
+	if _, ok := call.Object.(*ast.SuperExpression); !ok {
+		t.Errorf("call.Object is not ast.SuperExpression. got=%T", call.Object)
+	}
+}
+
+func TestTraitStatement(t *testing.T) {
+	input := `trait Speaker { function speak(); function rename(a, b) function greet() { "hi" } }
+class Dog extends Animal implements Speaker, Named { function speak() { "woof" } }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	trait, ok := program.Statements[0].(*ast.TraitStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.TraitStatement. got=%T", program.Statements[0])
+	}
+	if trait.Name.Value != "Speaker" {
+		t.Errorf("trait name wrong. want=%q, got=%q", "Speaker", trait.Name.Value)
+	}
+	if len(trait.Required) != 2 {
+		t.Fatalf("wrong number of required methods. want=2, got=%d", len(trait.Required))
+	}
+	if trait.Required[0].String() != "function speak();" || trait.Required[1].String() != "function rename(a, b);" {
+		t.Errorf("wrong required methods. got=%q, %q", trait.Required[0].String(), trait.Required[1].String())
+	}
+	if len(trait.Methods) != 1 || trait.Methods[0].Name.Value != "greet" {
+		t.Errorf("wrong default methods. got=%v", trait.Methods)
+	}
+
+	class, ok := program.Statements[1].(*ast.ClassStatement)
+	if !ok {
+		t.Fatalf("program.Statements[1] is not ast.ClassStatement. got=%T", program.Statements[1])
+	}
+	if !testIdentifier(t, class.ClassLiteral.Parent, "Animal") {
+		return
+	}
+	if len(class.ClassLiteral.Traits) != 2 {
+		t.Fatalf("wrong number of traits. want=2, got=%d", len(class.ClassLiteral.Traits))
+	}
+	testIdentifier(t, class.ClassLiteral.Traits[0], "Speaker")
+	testIdentifier(t, class.ClassLiteral.Traits[1], "Named")
+}
+
+func TestStaticStatements(t *testing.T) {
+	input := `class Counter { static let count = 0; static const max = 10; let n = 0; static function create() { new Counter() } function inc() { n++ } }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ClassStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ClassStatement. got=%T", program.Statements[0])
+	}
+	lit := stmt.ClassLiteral
+	if len(lit.Members) != 1 || lit.Members[0].Name.Value != "n" {
+		t.Errorf("wrong members. got=%v", lit.Members)
+	}
+	if len(lit.StaticMembers) != 2 {
+		t.Fatalf("wrong number of static members. want=2, got=%d", len(lit.StaticMembers))
+	}
+	if lit.StaticMembers[0].Name.Value != "count" || lit.StaticMembers[1].Name.Value != "max" || !lit.StaticMembers[1].IsConst() {
+		t.Errorf("wrong static members. got=%q, %q", lit.StaticMembers[0].String(), lit.StaticMembers[1].String())
+	}
+	if _, ok := lit.Methods["inc"]; !ok || len(lit.Methods) != 1 {
+		t.Errorf("wrong methods. got=%v", lit.Methods)
+	}
+	if _, ok := lit.StaticMethods["create"]; !ok || len(lit.StaticMethods) != 1 {
+		t.Errorf("wrong static methods. got=%v", lit.StaticMethods)
+	}
+}
+
+func TestStaticStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"static let x = 1;", "1:1: static is only allowed in a class body"},
+		{"class C { function f() { static let x = 1 } }", "1:26: static is only allowed in a class body"},
+		{"class C { static x }", "1:18: static must be followed by let, const or function, got IDENT"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("expected 1 error for %q, got=%d: %q", tt.input, len(errors), errors)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestParserErrorPositions(t *testing.T) {
+	input := `let x = 5;
+let = 10;`
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Diagnostics()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+	if errors[0].Pos.Line != 2 || errors[0].Pos.Column != 5 {
+		t.Errorf("wrong error position. expected=2:5, got=%s", errors[0].Pos)
+	}
+	expected := "2:5: expected next token to be IDENT,got = instead"
+	if p.Errors()[0] != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, p.Errors()[0])
+	}
+}
+
+func TestParserErrorRecovery(t *testing.T) {
+	input := `let x = 5;
+let = 10;
+let y = x + ;
+let z = 3;
+fn(a, 1) { a };
+z;
+++ ++ +;
+let = 5;`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	expectedErrors := []string{
+		"2:5: expected next token to be IDENT,got = instead",
+		"3:13: no prefix parse function for ; found",
+		"5:7: expected next token to be IDENT,got INT instead",
+		"7:7: no prefix parse function for + found",
+		"8:5: expected next token to be IDENT,got = instead",
+	}
+	errors := p.Errors()
+	if len(errors) != len(expectedErrors) {
+		t.Fatalf("wrong number of errors. expected=%d, got=%d: %q", len(expectedErrors), len(errors), errors)
+	}
+	for i, expected := range expectedErrors {
+		if errors[i] != expected {
+			t.Errorf("errors[%d] wrong. expected=%q, got=%q", i, expected, errors[i])
+		}
+	}
+
+	//壊れた文を飛ばして、残りの文は読めている
+	expectedStatements := []string{"let x = 5;", "let z = 3;", "z"}
+	if len(program.Statements) != len(expectedStatements) {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d", len(expectedStatements), len(program.Statements))
+	}
+	for i, expected := range expectedStatements {
+		if program.Statements[i].String() != expected {
+			t.Errorf("Statements[%d] wrong. expected=%q, got=%q", i, expected, program.Statements[i].String())
+		}
+	}
+}
+
+func TestParserErrorRecoveryInBlock(t *testing.T) {
+	input := `let f = fn(x) {
+	let = 1;
+	x * 2;
+};
+f(3);`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 1 {
+		t.Fatalf("expected 1 error, got=%d: %q", len(p.Errors()), p.Errors())
+	}
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	expected := "let f = fn(x)(x * 2);"
+	if program.Statements[0].String() != expected {
+		t.Errorf("wrong statement. expected=%q, got=%q", expected, program.Statements[0].String())
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	l := lexer.New("let 5 = x;")
+	p := New(l)
+	p.ParseProgram()
+
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got=%d", len(diagnostics))
+	}
+	d := diagnostics[0]
+	if d.Severity != SeverityError {
+		t.Errorf("wrong severity. got=%s", d.Severity)
+	}
+	if d.Pos.Line != 1 || d.Pos.Column != 5 {
+		t.Errorf("wrong position. expected=1:5, got=%s", d.Pos)
+	}
+	if len(d.Expected) != 1 || d.Expected[0] != token.IDENT {
+		t.Errorf("wrong expected tokens. got=%v", d.Expected)
+	}
+	if d.Found != token.INT {
+		t.Errorf("wrong found token. expected=%s, got=%s", token.INT, d.Found)
+	}
+}
+
+func TestMalformedInputDoesNotPanic(t *testing.T) {
+	inputs := []string{
+		"class",
+		"class 5 { }",
+		"class A",
+		"class A { 5 }",
+		"class A { let x = 1; x + }",
+		"class A extends",
+		"class A implements",
+		"class A implements B,",
+		"class A { static }",
+		"trait",
+		"trait T",
+		"trait T { function }",
+		"trait T { function f(",
+		"trait T { let x = 1 }",
+		"function",
+		"function f",
+		"function f(",
+		"function 1() {}",
+		"new",
+		"new A",
+		"new 5;",
+		"new a.",
+		"new a.5()",
+		"return",
+		"fn(1, 2) {}",
+		"fn(x,",
+		"if (x",
+		"if (x) {",
+		"while (",
+		"for (",
+		"for (i = 0; i < 10",
+		"a.",
+		"a.5",
+		"1 = 2",
+		"(1 + ) = 3",
+		"{1: }",
+		"{1 2}",
+		"[1, 2",
+		"x[1",
+		"\"${",
+		"\"${1 +}\"",
+		"}}}",
+		")))",
+		"let let let",
+		"= = =",
+		"++ ++ +;",
+		"-- ++ (1 +);",
+	}
+
+	for _, input := range inputs {
+		l := lexer.New(input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		if program == nil {
+			t.Errorf("ParseProgram returned nil for %q", input)
+		}
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q, got none", input)
+		}
+		for _, d := range p.Diagnostics() {
+			if strings.HasPrefix(d.Message, "internal parser error") {
+				t.Errorf("parser panicked on %q: %s", input, d.Message)
+			}
+		}
+	}
+}
+
+func TestCommentsAreKept(t *testing.T) {
+	input := `// xの定義
+let x = 5;
+/* 二倍にする */
+x * 2; // 結果
+`
+
+	l := lexer.New(input)
+	l.KeepComments = true
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	if program.String() != "let x = 5;(x * 2)" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+	if len(program.Comments) != 3 {
+		t.Fatalf("program.Comments does not contain 3 comments. got=%d", len(program.Comments))
+	}
+
+	letStmt := program.Statements[0].(*ast.LetStatement)
+	if len(letStmt.Token.Comments) != 1 || letStmt.Token.Comments[0].Text != "// xの定義" {
+		t.Errorf("let statement has wrong comments. got=%+v", letStmt.Token.Comments)
+	}
+	exprStmt := program.Statements[1].(*ast.ExpressionStatement)
+	if len(exprStmt.Token.Comments) != 1 || exprStmt.Token.Comments[0].Text != "/* 二倍にする */" {
+		t.Errorf("expression statement has wrong comments. got=%+v", exprStmt.Token.Comments)
+	}
+}
+
+func TestLexerErrorsAreReported(t *testing.T) {
+	input := `let s = "abc;`
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("wrong number of errors. expected=1, got=%d (%v)", len(errors), errors)
+	}
+	if errors[0] != "1:9: unterminated string literal" {
+		t.Errorf("wrong error. got=%q", errors[0])
+	}
+}
+
+func TestInterpolatedStringParsing(t *testing.T) {
+	input := `"a${x + 1}b${f(y)}"`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	str, ok := stmt.Expression.(*ast.InterpolatedString)
+	if !ok {
+		t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+	}
+	if len(str.Parts) != 5 {
+		t.Fatalf("wrong number of parts. expected=5, got=%d", len(str.Parts))
+	}
+	testInfixExpression(t, str.Parts[1], "x", "+", 1)
+	if str.String() != "a${(x + 1)}b${f(y)}" {
+		t.Errorf("str.String() wrong. got=%q", str.String())
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/token"
 	"strings"
 
 	"github.com/chzyer/readline"
@@ -49,7 +50,7 @@ func Start(in io.Reader, out io.Writer) {
 		program := p.ParseProgram()
 
 		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+			printParserErrors(out, line, p.Diagnostics())
 			continue
 		}
 
@@ -58,7 +59,9 @@ func Start(in io.Reader, out io.Writer) {
 		switch {
 		case line == "":
 		default:
-			if evaluated != nil {
+			if errObj, ok := evaluated.(*object.Error); ok {
+				printError(out, line, errObj)
+			} else if evaluated != nil {
 				io.WriteString(out, evaluated.Inspect()) //結果を出力する(Inspectはstring)
 				io.WriteString(out, "\n")
 			}
@@ -66,17 +69,58 @@ func Start(in io.Reader, out io.Writer) {
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
+func printParserErrors(out io.Writer, source string, errors []*parser.Diagnostic) {
 	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
 	io.WriteString(out, " parser errors:\n")
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+	for _, e := range errors {
+		io.WriteString(out, "\t"+e.Error()+"\n")
+		printSourceLine(out, source, e.Pos)
 	}
 }
 
+//評価時のエラーを位置とソースの該当箇所つきで出力する
+func printError(out io.Writer, source string, err *object.Error) {
+	io.WriteString(out, err.Inspect()+"\n")
+	printSourceLine(out, source, err.Pos)
+}
+
+//posの行を表示し、その下の該当する列に^で印をつける
+func printSourceLine(out io.Writer, source string, pos token.Position) {
+	if !pos.IsValid() {
+		return
+	}
+	lines := strings.Split(source, "\n")
+	if pos.Line > len(lines) {
+		return
+	}
+	line := strings.TrimRight(lines[pos.Line-1], "\r")
+
+	//タブはそのまま残して、^の位置がずれないようにする
+	var caret strings.Builder
+	col := 1
+	for _, r := range line {
+		if col >= pos.Column {
+			break
+		}
+		if r == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+		col++
+	}
+	for ; col < pos.Column; col++ { //行末より後ろ(EOFなど)を指している場合
+		caret.WriteRune(' ')
+	}
+	caret.WriteString("^")
+
+	io.WriteString(out, "\t"+line+"\n")
+	io.WriteString(out, "\t"+caret.String()+"\n")
+}
+
 func filterInput(r rune) (rune, bool) {
 	switch r {
-	// block CtrlZ feature
+	//block CtrlZ feature
 	case readline.CharCtrlZ:
 		return r, false
 	}
@@ -0,0 +1,78 @@
+package repl
+
+import (
+	"io"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"strings"
+)
+
+//スクリプト実行時の終了コード
+const (
+	ExitOK         = 0
+	ExitError      = 1 //実行時エラー(捕まえられなかったobject.Error)
+	ExitParseError = 2 //構文エラー
+)
+
+//ファイルや-eで渡されたプログラムを実行して、終了コードを返す。
+//argsはスクリプトに渡す引数で、ARGVとしてプログラムから参照できる。
+func Run(filename, source string, args []string, out io.Writer) int {
+	source = stripShebang(source)
+
+	l := lexer.NewWithFilename(filename, source)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, source, p.Diagnostics())
+		return ExitParseError
+	}
+
+	env := NewScriptEnvironment(args)
+	evaluated := evaluator.Eval(program, env)
+
+	if errObj, ok := evaluated.(*object.Error); ok {
+		printError(out, source, errObj)
+		return ExitError
+	}
+	return ExitOK
+}
+
+//スクリプト用のグローバル環境を作成する。
+//ARGVにスクリプト引数の配列、ENVに環境変数のハッシュを入れておく。
+func NewScriptEnvironment(args []string) *object.Environment {
+	env := object.NewEnvironment()
+
+	argv := make([]object.Object, 0, len(args))
+	for _, arg := range args {
+		argv = append(argv, &object.String{Value: arg})
+	}
+	env.Set("ARGV", &object.Array{Elements: argv})
+
+	pairs := make(map[object.HashKey]object.HashPair)
+	for _, kv := range os.Environ() {
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			continue
+		}
+		key := &object.String{Value: kv[:i]}
+		pairs[key.HashKey()] = object.HashPair{Key: key, Value: &object.String{Value: kv[i+1:]}}
+	}
+	env.Set("ENV", &object.Hash{Pairs: pairs})
+
+	return env
+}
+
+//先頭の#!行を読み飛ばす。行番号がずれないように改行は残しておく
+func stripShebang(source string) string {
+	if !strings.HasPrefix(source, "#!") {
+		return source
+	}
+	if i := strings.Index(source, "\n"); i >= 0 {
+		return source[i:]
+	}
+	return ""
+}
@@ -0,0 +1,153 @@
+package repl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+//fの実行中に標準出力(putsの出力先)へ書かれたものを返す
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe failed: %s", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan []byte)
+	go func() {
+		out, _ := ioutil.ReadAll(r)
+		done <- out
+	}()
+
+	f()
+	w.Close()
+	return string(<-done)
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name           string
+		source         string
+		args           []string
+		expectedCode   int
+		expectedStdout string
+		expectedOut    string //エラーの出力先(Runのout)
+	}{
+		{
+			"success",
+			`puts(1 + 2); puts("ok")`,
+			nil,
+			ExitOK,
+			"3\nok\n",
+			"",
+		},
+		{
+			"runtime error",
+			"puts(1);\nlet x = 5 + true;\nputs(2)",
+			nil,
+			ExitError,
+			"1\n",
+			"ERROR: test.gm:2:11: type mismatch: INTEGER + BOOLEAN\n\tlet x = 5 + true;\n\t          ^\n",
+		},
+		{
+			"parse error",
+			"puts(1);\nlet = 5;",
+			nil,
+			ExitParseError,
+			"",
+			"Woops! We ran into some monkey business here!\n parser errors:\n\ttest.gm:2:5: expected next token to be IDENT,got = instead\n\tlet = 5;\n\t    ^\n",
+		},
+		{
+			"shebang",
+			"#!/usr/bin/env genmaru\nputs(\"hi\")\nputs(x)",
+			nil,
+			ExitError,
+			"hi\n",
+			"ERROR: test.gm:3:6: identifier not found: x\n\tputs(x)\n\t     ^\n",
+		},
+		{
+			"shebang only",
+			"#!/usr/bin/env genmaru",
+			nil,
+			ExitOK,
+			"",
+			"",
+		},
+		{
+			"arguments",
+			`puts(len(ARGV)); puts(ARGV[0]); puts(ARGV[1])`,
+			[]string{"a", "b c"},
+			ExitOK,
+			"2\na\nb c\n",
+			"",
+		},
+		{
+			"no arguments",
+			`puts(ARGV)`,
+			nil,
+			ExitOK,
+			"[]\n",
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		var code int
+		stdout := captureStdout(t, func() {
+			code = Run("test.gm", tt.source, tt.args, &out)
+		})
+
+		if code != tt.expectedCode {
+			t.Errorf("%s: wrong exit code. expected=%d, got=%d", tt.name, tt.expectedCode, code)
+		}
+		if stdout != tt.expectedStdout {
+			t.Errorf("%s: wrong stdout. expected=%q, got=%q", tt.name, tt.expectedStdout, stdout)
+		}
+		if out.String() != tt.expectedOut {
+			t.Errorf("%s: wrong error output. expected=%q, got=%q", tt.name, tt.expectedOut, out.String())
+		}
+	}
+}
+
+//ENVには実行時の環境変数が入る
+func TestScriptEnvironment(t *testing.T) {
+	os.Setenv("GENMARU_TEST_VAR", "a=b")
+	defer os.Unsetenv("GENMARU_TEST_VAR")
+
+	var out bytes.Buffer
+	var code int
+	stdout := captureStdout(t, func() {
+		code = Run("test.gm", `puts(ENV["GENMARU_TEST_VAR"]); puts(ENV["GENMARU_NOT_SET"])`, nil, &out)
+	})
+
+	if code != ExitOK {
+		t.Fatalf("wrong exit code. expected=%d, got=%d (%s)", ExitOK, code, out.String())
+	}
+	if stdout != "a=b\nnull\n" {
+		t.Errorf("wrong stdout. got=%q", stdout)
+	}
+}
+
+func TestStripShebang(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"#!/usr/bin/env genmaru\nputs(1)", "\nputs(1)"}, //行番号がずれないよう改行は残る
+		{"#!/usr/bin/env genmaru", ""},
+		{"puts(1)\n#!x", "puts(1)\n#!x"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := stripShebang(tt.input); got != tt.expected {
+			t.Errorf("stripShebang(%q) wrong. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
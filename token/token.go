@@ -1,10 +1,48 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType //属性(識別子とか{とか数字とか)
 	Literal string    //文字部(実体の部分)
+	Pos     Position  //ソース上の位置(トークンの先頭文字)
+
+	//このトークンの直前にあるコメント。字句解析器のKeepCommentsがtrueの時だけ入る
+	Comments []Comment
+}
+
+//ソース中のコメント。Textは//や/* */も含めたそのままの文字列
+type Comment struct {
+	Text string
+	Pos  Position
+}
+
+//ソース上の位置。Line,Columnは1始まりで、0の場合は位置不明を表す。
+type Position struct {
+	Filename string
+	Line     int
+	Column   int
+}
+
+//位置情報を持っているかどうか
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+//file:line:col の形式で返す。ファイル名がない場合はline:colのみ
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.Filename != "" {
+			return p.Filename
+		}
+		return "-"
+	}
+	if p.Filename != "" {
+		return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
@@ -13,19 +51,38 @@ const (
 
 	IDENT = "IDENT"
 	INT   = "INT"
+	FLOAT = "FLOAT"
 
 	STRING = "STRING"
 
+	//埋め込み式のある文字列 "a${x}b${y}c" は INTERP_HEAD("a") x INTERP_MID("b") y INTERP_TAIL("c") になる
+	INTERP_HEAD = "INTERP_HEAD"
+	INTERP_MID  = "INTERP_MID"
+	INTERP_TAIL = "INTERP_TAIL"
+
 	//演算子
-	ASSIGN   = "="
+	ASSIGN = "="
+	//複合代入
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+	PERCENT_ASSIGN  = "%="
+
 	PLUS     = "+"
 	MINUS    = "-"
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
+
+	LT    = "<"
+	GT    = ">"
+	LT_EQ = "<="
+	GT_EQ = ">="
 
-	LT = "<"
-	GT = ">"
+	AND = "&&"
+	OR  = "||"
 
 	EQ        = "=="
 	NOT_EQ    = "!="
@@ -36,8 +93,9 @@ const (
 	COMMA     = ","
 	SEMICOLON = ";"
 
-	COLON = ":"
-	DOT   = "."
+	COLON  = ":"
+	DOT    = "."
+	DOTDOT = ".." //範囲 0..n
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -51,6 +109,7 @@ const (
 	FUNC_DEC = "FUNC_DEC"
 	WHILE    = "WHILE"
 	LET      = "LET"
+	CONST    = "CONST"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	IF       = "IF"
@@ -59,6 +118,17 @@ const (
 	CLASS    = "CLASS"
 	NEW      = "NEW"
 	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+
+	//継承
+	EXTENDS    = "EXTENDS"
+	SUPER      = "SUPER"
+	THIS       = "THIS"       //メソッドを呼び出したインスタンス
+	INSTANCEOF = "INSTANCEOF" //インスタンスがクラス(またはその子クラス)のものかを調べる
+	STATIC     = "STATIC"     //クラスに1つだけあるフィールドとメソッド
+	TRAIT      = "TRAIT"      //クラスが持つべきメソッドの宣言
 )
 
 var keywords = map[string]TokenType{
@@ -66,6 +136,7 @@ var keywords = map[string]TokenType{
 	"function": FUNC_DEC,
 	"while":    WHILE,
 	"let":      LET,
+	"const":    CONST,
 	"true":     TRUE,
 	"false":    FALSE,
 	"if":       IF,
@@ -74,6 +145,16 @@ var keywords = map[string]TokenType{
 	"class":    CLASS,
 	"new":      NEW,
 	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+
+	"extends":    EXTENDS,
+	"super":      SUPER,
+	"this":       THIS,
+	"static":     STATIC,
+	"trait":      TRAIT,
+	"instanceof": INSTANCEOF,
 }
 
 //渡された識別子がキーワードかどうかを確認、違うのならばTokenType定数を返す。